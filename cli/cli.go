@@ -10,17 +10,29 @@ import (
 	idemixcommon "github.com/minvws/nl-covid19-coronacheck-idemix/common"
 	mobilecore "github.com/minvws/nl-covid19-coronacheck-mobile-core"
 	"os"
+	"strconv"
 	"time"
 )
 
 func main() {
-	availableCommandsMsg := "Available commands: verify, proofidentifier, commitments"
+	availableCommandsMsg := "Available commands: verify, verify-batch, serve, decode, issue-dcc, issue-domestic, compare-configs, proofidentifier, commitments, explain, timeline"
 
 	// Subcommands
 	verifyCmd := flag.NewFlagSet("verify", flag.ExitOnError)
 	verifyConfigPath := verifyCmd.String("configdir", "./testdata", "Config directory to use")
 	verifyTimestamp := verifyCmd.Int64("timestamp", time.Now().Unix(), "Timestamp of verification to use")
 	verifyPolicy := verifyCmd.String("verificationpolicy", "3G", "Verification policy to use")
+	verifyImagePath := verifyCmd.String("image", "", "PNG or JPEG file, or directory of them, to decode the QRs from instead of a QR argument")
+
+	verifyBatchCmd := flag.NewFlagSet("verify-batch", flag.ExitOnError)
+	verifyBatchConfigPath := verifyBatchCmd.String("configdir", "./testdata", "Config directory to use")
+	verifyBatchInput := verifyBatchCmd.String("input", "-", "File with a QR or JSON object with id, qr and optional timestamp per line, or - for stdin")
+	verifyBatchTimestamp := verifyBatchCmd.Int64("timestamp", time.Now().Unix(), "Timestamp of verification to use when a line has none")
+	verifyBatchPolicies := verifyBatchCmd.String("verificationpolicies", "3G", "Comma separated verification policies to use")
+
+	serveCmd := flag.NewFlagSet("serve", flag.ExitOnError)
+	serveConfigPath := serveCmd.String("configdir", "./testdata", "Config directory to use, which is reloaded on SIGHUP")
+	serveAddress := serveCmd.String("address", "127.0.0.1:8080", "Address to listen on")
 
 	proofIdentifierCmd := flag.NewFlagSet("proofidentifier", flag.ExitOnError)
 	proofIdentifierConfigPath := proofIdentifierCmd.String("configdir", "./testdata", "Config directory to use")
@@ -32,6 +44,31 @@ func main() {
 	explainCmd := flag.NewFlagSet("explain", flag.ExitOnError)
 	explainConfigPath := explainCmd.String("configdir", "./testdata", "Config directory to use")
 	explainTimestamp := explainCmd.Int64("timestamp", time.Now().Unix(), "Timestamp of verification to use")
+	explainImagePath := explainCmd.String("image", "", "PNG or JPEG file, or directory of them, to decode the QRs from instead of a QR argument")
+
+	timelineCmd := flag.NewFlagSet("timeline", flag.ExitOnError)
+	timelineConfigPath := timelineCmd.String("configdir", "./testdata", "Config directory to use")
+	timelineFrom := timelineCmd.Int64("from", time.Now().AddDate(0, 0, -30).Unix(), "Timestamp of the start of the timeline")
+	timelineUntil := timelineCmd.Int64("until", time.Now().AddDate(1, 0, 0).Unix(), "Timestamp of the end of the timeline")
+	timelineStep := timelineCmd.Duration("step", time.Hour, "Interval to verify at, where changes that are undone within a step are not noticed")
+	timelinePolicies := timelineCmd.String("verificationpolicies", "1G,3G", "Comma separated verification policies to use")
+	timelineTimeZone := timelineCmd.String("timezone", "Local", "Time zone to print the transition moments in")
+	timelineImagePath := timelineCmd.String("image", "", "PNG or JPEG file, or directory of them, to decode the QRs from instead of a QR argument")
+
+	decodeCmd := flag.NewFlagSet("decode", flag.ExitOnError)
+
+	issueDCCCmd := flag.NewFlagSet("issue-dcc", flag.ExitOnError)
+	issueDCCOptions := newIssueDCCOptions(issueDCCCmd)
+
+	issueDomesticCmd := flag.NewFlagSet("issue-domestic", flag.ExitOnError)
+	issueDomesticOptions := newIssueDomesticOptions(issueDomesticCmd)
+
+	compareConfigsCmd := flag.NewFlagSet("compare-configs", flag.ExitOnError)
+	compareConfigsOldConfigPath := compareConfigsCmd.String("oldconfigdir", "./testdata", "Config directory with the current rules")
+	compareConfigsNewConfigPath := compareConfigsCmd.String("newconfigdir", "", "Config directory with the new rules")
+	compareConfigsInput := compareConfigsCmd.String("input", "-", "File with a QR, or JSON object with id and either qr or an unsigned dcc with optional issuer, per line, or - for stdin")
+	compareConfigsTimestamps := compareConfigsCmd.String("timestamps", strconv.FormatInt(time.Now().Unix(), 10), "Comma separated timestamps of verification to use")
+	compareConfigsPolicies := compareConfigsCmd.String("verificationpolicies", "3G", "Comma separated verification policies to use")
 
 	if len(os.Args) < 2 {
 		_, _ = fmt.Fprintln(os.Stderr, availableCommandsMsg)
@@ -41,12 +78,26 @@ func main() {
 	switch os.Args[1] {
 	case verifyCmd.Name():
 		_ = verifyCmd.Parse(os.Args[2:])
+	case verifyBatchCmd.Name():
+		_ = verifyBatchCmd.Parse(os.Args[2:])
+	case serveCmd.Name():
+		_ = serveCmd.Parse(os.Args[2:])
 	case commitmentsCmd.Name():
 		_ = commitmentsCmd.Parse(os.Args[2:])
 	case proofIdentifierCmd.Name():
 		_ = proofIdentifierCmd.Parse(os.Args[2:])
 	case explainCmd.Name():
 		_ = explainCmd.Parse(os.Args[2:])
+	case timelineCmd.Name():
+		_ = timelineCmd.Parse(os.Args[2:])
+	case decodeCmd.Name():
+		_ = decodeCmd.Parse(os.Args[2:])
+	case issueDCCCmd.Name():
+		_ = issueDCCCmd.Parse(os.Args[2:])
+	case issueDomesticCmd.Name():
+		_ = issueDomesticCmd.Parse(os.Args[2:])
+	case compareConfigsCmd.Name():
+		_ = compareConfigsCmd.Parse(os.Args[2:])
 	default:
 		_, _ = fmt.Fprintln(os.Stderr, availableCommandsMsg)
 		flag.PrintDefaults()
@@ -54,7 +105,23 @@ func main() {
 	}
 
 	if verifyCmd.Parsed() {
-		err := runVerify(verifyCmd, *verifyConfigPath, *verifyTimestamp, *verifyPolicy)
+		err := runVerify(verifyCmd, *verifyConfigPath, *verifyTimestamp, *verifyPolicy, *verifyImagePath)
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	}
+
+	if verifyBatchCmd.Parsed() {
+		err := runVerifyBatch(*verifyBatchConfigPath, *verifyBatchInput, *verifyBatchTimestamp, *verifyBatchPolicies)
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	}
+
+	if serveCmd.Parsed() {
+		err := runServe(*serveConfigPath, *serveAddress)
 		if err != nil {
 			_, _ = fmt.Fprintln(os.Stderr, err.Error())
 			os.Exit(1)
@@ -78,7 +145,47 @@ func main() {
 	}
 
 	if explainCmd.Parsed() {
-		err := runExplain(explainCmd, *explainConfigPath, *explainTimestamp)
+		err := runExplain(explainCmd, *explainConfigPath, *explainTimestamp, *explainImagePath)
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	}
+
+	if timelineCmd.Parsed() {
+		err := runTimeline(timelineCmd, *timelineConfigPath, *timelineFrom, *timelineUntil, *timelineStep, *timelinePolicies, *timelineTimeZone, *timelineImagePath)
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	}
+
+	if decodeCmd.Parsed() {
+		err := runDecode(decodeCmd)
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	}
+
+	if issueDCCCmd.Parsed() {
+		err := runIssueDCC(issueDCCOptions)
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	}
+
+	if issueDomesticCmd.Parsed() {
+		err := runIssueDomestic(issueDomesticOptions)
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	}
+
+	if compareConfigsCmd.Parsed() {
+		err := runCompareConfigs(*compareConfigsOldConfigPath, *compareConfigsNewConfigPath, *compareConfigsInput, *compareConfigsTimestamps, *compareConfigsPolicies, os.Stdout)
 		if err != nil {
 			_, _ = fmt.Fprintln(os.Stderr, err.Error())
 			os.Exit(1)
@@ -86,11 +193,11 @@ func main() {
 	}
 }
 
-func runVerify(verifyFlags *flag.FlagSet, configPath string, timestamp int64, givenVerificationPolicy string) error {
+func runVerify(verifyFlags *flag.FlagSet, configPath string, timestamp int64, givenVerificationPolicy string, imagePath string) error {
 	// Make sure QR is given and config path exists
-	qr := verifyFlags.Arg(0)
-	if len(qr) == 0 {
-		return errors.Errorf("No QR was given")
+	qrs, err := collectQRs(verifyFlags, imagePath)
+	if err != nil {
+		return err
 	}
 
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
@@ -109,6 +216,12 @@ func runVerify(verifyFlags *flag.FlagSet, configPath string, timestamp int64, gi
 		return errors.Errorf("Could not initialize verifier: %s\n", initializeResult.Error)
 	}
 
+	return forEachQR(qrs, func(qr string) error {
+		return verifyQR(qr, policy, timestamp)
+	})
+}
+
+func verifyQR(qr string, policy string, timestamp int64) error {
 	// Verify
 	verifyResult := mobilecore.VerifyWithTime([]byte(qr), policy, timestamp)
 	if verifyResult.Error != "" {
@@ -206,11 +319,11 @@ func runCommitments(commitments *flag.FlagSet, configPath *string, issueSpecific
 	return nil
 }
 
-func runExplain(explainFlags *flag.FlagSet, configPath string, timestamp int64) error {
+func runExplain(explainFlags *flag.FlagSet, configPath string, timestamp int64, imagePath string) error {
 	// Make sure QR is given and config path exists
-	qr := []byte(explainFlags.Arg(0))
-	if len(qr) == 0 {
-		return errors.Errorf("No QR was given")
+	qrs, err := collectQRs(explainFlags, imagePath)
+	if err != nil {
+		return err
 	}
 
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
@@ -223,6 +336,12 @@ func runExplain(explainFlags *flag.FlagSet, configPath string, timestamp int64)
 		return errors.Errorf("Could not initialize verifier: %s\n", initializeResult.Error)
 	}
 
+	return forEachQR(qrs, func(qr string) error {
+		return explainQR([]byte(qr), timestamp)
+	})
+}
+
+func explainQR(qr []byte, timestamp int64) error {
 	_, europeanVerifier := mobilecore.GetVerifiersForCLI()
 
 	if idemixcommon.HasNLPrefix(qr) {
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/go-errors/errors"
+	hcertcommon "github.com/minvws/nl-covid19-coronacheck-hcert/common"
+	idemixcommon "github.com/minvws/nl-covid19-coronacheck-idemix/common"
+	mobilecore "github.com/minvws/nl-covid19-coronacheck-mobile-core"
+	"github.com/minvws/nl-covid19-coronacheck-mobile-core/dccissuer"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	STATEMENT_TYPE_DOMESTIC = "domestic"
+	STATEMENT_TYPE_UNKNOWN  = "unknown"
+)
+
+// compareInput is a single line of input, which is either a QR code or an unsigned DCC payload.
+//  A DCC payload is signed with a temporary key that is only trusted while comparing.
+type compareInput struct {
+	Id     string           `json:"id"`
+	QR     string           `json:"qr"`
+	DCC    *hcertcommon.DCC `json:"dcc"`
+	Issuer string           `json:"issuer"`
+
+	issuerCountry string
+	statementType string
+}
+
+type compareOutcome struct {
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type compareChange struct {
+	Id            string          `json:"id"`
+	Policy        string          `json:"policy"`
+	Timestamp     int64           `json:"timestamp"`
+	IssuerCountry string          `json:"issuerCountry"`
+	StatementType string          `json:"statementType"`
+	Old           *compareOutcome `json:"old"`
+	New           *compareOutcome `json:"new"`
+}
+
+// compareCounts counts the verified cases, the cases that changed, and how many changed
+//  from success to another status and vice versa
+type compareCounts struct {
+	Total         int `json:"total"`
+	Changed       int `json:"changed"`
+	NewlyAccepted int `json:"newlyAccepted"`
+	NewlyRejected int `json:"newlyRejected"`
+}
+
+type compareSummary struct {
+	compareCounts
+	PerIssuerCountry map[string]*compareCounts `json:"perIssuerCountry"`
+	PerStatementType map[string]*compareCounts `json:"perStatementType"`
+}
+
+func runCompareConfigs(oldConfigPath, newConfigPath, inputPath, givenTimestamps, givenVerificationPolicies string, output io.Writer) error {
+	for _, configPath := range []string{oldConfigPath, newConfigPath} {
+		if _, err := os.Stat(configPath); os.IsNotExist(err) {
+			return errors.Errorf("Config directory '%s' does not exist\n", configPath)
+		}
+	}
+
+	var comparePolicies []string
+	for _, givenPolicy := range strings.Split(givenVerificationPolicies, ",") {
+		if _, ok := policies[givenPolicy]; !ok {
+			return errors.Errorf("Unrecognized verification policy '%s'. Allowed values are: 1G, 3G", givenPolicy)
+		}
+
+		comparePolicies = append(comparePolicies, givenPolicy)
+	}
+
+	var timestamps []int64
+	for _, givenTimestamp := range strings.Split(givenTimestamps, ",") {
+		timestamp, err := strconv.ParseInt(strings.TrimSpace(givenTimestamp), 10, 64)
+		if err != nil {
+			return errors.WrapPrefix(err, "Could not parse timestamp", 0)
+		}
+
+		timestamps = append(timestamps, timestamp)
+	}
+
+	inputs, err := readCompareInputs(inputPath)
+	if err != nil {
+		return err
+	}
+
+	tempPath, err := os.MkdirTemp("", "compare-configs")
+	if err != nil {
+		return errors.WrapPrefix(err, "Could not create temporary directory", 0)
+	}
+
+	defer os.RemoveAll(tempPath)
+
+	// Sign the DCC payloads, and trust the signing key in copies of both config directories
+	oldConfigPath, newConfigPath, err = signCompareInputs(inputs, timestamps, oldConfigPath, newConfigPath, tempPath)
+	if err != nil {
+		return err
+	}
+
+	for _, input := range inputs {
+		input.issuerCountry, input.statementType = classifyCertificateShape([]byte(input.QR))
+	}
+
+	// The verifier state is global, so all cases are verified with one config before the other
+	oldOutcomes, err := verifyCompareInputs(oldConfigPath, inputs, timestamps, comparePolicies)
+	if err != nil {
+		return err
+	}
+
+	newOutcomes, err := verifyCompareInputs(newConfigPath, inputs, timestamps, comparePolicies)
+	if err != nil {
+		return err
+	}
+
+	summary := &compareSummary{
+		PerIssuerCountry: map[string]*compareCounts{},
+		PerStatementType: map[string]*compareCounts{},
+	}
+
+	encoder := json.NewEncoder(output)
+	i := 0
+	for _, input := range inputs {
+		for _, timestamp := range timestamps {
+			for _, givenPolicy := range comparePolicies {
+				oldOutcome, newOutcome := oldOutcomes[i], newOutcomes[i]
+				i++
+
+				summary.count(input, oldOutcome, newOutcome)
+				if *oldOutcome == *newOutcome {
+					continue
+				}
+
+				err = encoder.Encode(&compareChange{
+					Id:            input.Id,
+					Policy:        givenPolicy,
+					Timestamp:     timestamp,
+					IssuerCountry: input.issuerCountry,
+					StatementType: input.statementType,
+					Old:           oldOutcome,
+					New:           newOutcome,
+				})
+				if err != nil {
+					return errors.WrapPrefix(err, "Could not write change", 0)
+				}
+			}
+		}
+	}
+
+	err = encoder.Encode(map[string]*compareSummary{"summary": summary})
+	if err != nil {
+		return errors.WrapPrefix(err, "Could not write summary", 0)
+	}
+
+	return nil
+}
+
+// readCompareInputs reads a QR code, or a JSON object with a QR code or DCC payload, per line
+func readCompareInputs(inputPath string) ([]*compareInput, error) {
+	var reader io.Reader = os.Stdin
+	if inputPath != "" && inputPath != "-" {
+		inputFile, err := os.Open(inputPath)
+		if err != nil {
+			return nil, errors.WrapPrefix(err, "Could not open input file", 0)
+		}
+
+		defer inputFile.Close()
+		reader = inputFile
+	}
+
+	var inputs []*compareInput
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		input := &compareInput{Id: strconv.Itoa(lineNumber), QR: line}
+		if strings.HasPrefix(line, "{") {
+			input.QR = ""
+			err := json.Unmarshal([]byte(line), input)
+			if err != nil {
+				return nil, errors.WrapPrefix(err, fmt.Sprintf("Could not JSON unmarshal line %d", lineNumber), 0)
+			}
+
+			if (input.QR == "") == (input.DCC == nil) {
+				return nil, errors.Errorf("Either a QR or a DCC should be given on line %d", lineNumber)
+			}
+		}
+
+		inputs = append(inputs, input)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.WrapPrefix(err, "Could not read input", 0)
+	}
+
+	return inputs, nil
+}
+
+// signCompareInputs issues the DCC payloads with a temporary signing key, and returns copies of the config
+//  directories within the temporary path that trust that key. Without DCC payloads, the config directories
+//  are returned as-is.
+func signCompareInputs(inputs []*compareInput, timestamps []int64, oldConfigPath, newConfigPath, tempPath string) (string, string, error) {
+	hasDCCs := false
+	for _, input := range inputs {
+		if input.DCC != nil {
+			hasDCCs = true
+			break
+		}
+	}
+
+	if !hasDCCs {
+		return oldConfigPath, newConfigPath, nil
+	}
+
+	key, err := dccissuer.GenerateSigningKey(dccissuer.KEY_TYPE_ECDSA, "", nil)
+	if err != nil {
+		return "", "", err
+	}
+
+	// The certificates are valid at all timestamps, so only the DCC determines the outcome
+	earliestTimestamp, latestTimestamp := timestamps[0], timestamps[0]
+	for _, timestamp := range timestamps {
+		if timestamp < earliestTimestamp {
+			earliestTimestamp = timestamp
+		}
+
+		if timestamp > latestTimestamp {
+			latestTimestamp = timestamp
+		}
+	}
+
+	for _, input := range inputs {
+		if input.DCC == nil {
+			continue
+		}
+
+		issuer := input.Issuer
+		if issuer == "" {
+			issuer = dccCountry(input.DCC)
+		}
+
+		qr, err := dccissuer.Issue(key, &dccissuer.Specification{
+			Issuer:         issuer,
+			IssuedAt:       earliestTimestamp,
+			ExpirationTime: time.Unix(latestTimestamp, 0).AddDate(1, 0, 0).Unix(),
+			DCC:            input.DCC,
+		})
+		if err != nil {
+			return "", "", errors.WrapPrefix(err, fmt.Sprintf("Could not sign DCC of case %s", input.Id), 0)
+		}
+
+		input.QR = string(qr)
+	}
+
+	var copiedPaths []string
+	for i, configPath := range []string{oldConfigPath, newConfigPath} {
+		copiedPath := filepath.Join(tempPath, strconv.Itoa(i))
+		err = copyVerifierConfig(configPath, copiedPath)
+		if err != nil {
+			return "", "", err
+		}
+
+		err = key.AddToPublicKeysFile(filepath.Join(copiedPath, mobilecore.VERIFIER_PUBLIC_KEYS_FILENAME))
+		if err != nil {
+			return "", "", err
+		}
+
+		copiedPaths = append(copiedPaths, copiedPath)
+	}
+
+	return copiedPaths[0], copiedPaths[1], nil
+}
+
+func copyVerifierConfig(configPath, copiedPath string) error {
+	err := os.MkdirAll(copiedPath, 0700)
+	if err != nil {
+		return errors.WrapPrefix(err, "Could not create config directory copy", 0)
+	}
+
+	for _, filename := range []string{mobilecore.VERIFIER_CONFIG_FILENAME, mobilecore.VERIFIER_PUBLIC_KEYS_FILENAME} {
+		content, err := os.ReadFile(filepath.Join(configPath, filename))
+		if err != nil {
+			return errors.WrapPrefix(err, "Could not read config file", 0)
+		}
+
+		err = os.WriteFile(filepath.Join(copiedPath, filename), content, 0600)
+		if err != nil {
+			return errors.WrapPrefix(err, "Could not write config file copy", 0)
+		}
+	}
+
+	return nil
+}
+
+func verifyCompareInputs(configPath string, inputs []*compareInput, timestamps []int64, comparePolicies []string) ([]*compareOutcome, error) {
+	initializeResult := mobilecore.InitializeVerifier(configPath)
+	if initializeResult.Error != "" {
+		return nil, errors.Errorf("Could not initialize verifier with '%s': %s\n", configPath, initializeResult.Error)
+	}
+
+	var outcomes []*compareOutcome
+	for _, input := range inputs {
+		for _, timestamp := range timestamps {
+			for _, givenPolicy := range comparePolicies {
+				result := verifyBatchInput(&batchInput{Id: input.Id, QR: input.QR, Timestamp: timestamp}, givenPolicy)
+				outcomes = append(outcomes, &compareOutcome{Status: result.Status, Reason: result.Reason})
+			}
+		}
+	}
+
+	return outcomes, nil
+}
+
+// classifyCertificateShape returns the issuer country and the statement types of a QR code, without verifying it
+func classifyCertificateShape(qr []byte) (issuerCountry, statementType string) {
+	if idemixcommon.HasNLPrefix(qr) {
+		return mobilecore.DCC_DOMESTIC_ISSUER_COUNTRY_CODE, STATEMENT_TYPE_DOMESTIC
+	}
+
+	cwt, err := hcertcommon.UnmarshalQREncoded(qr)
+	if err != nil {
+		return STATEMENT_TYPE_UNKNOWN, STATEMENT_TYPE_UNKNOWN
+	}
+
+	hcert, err := hcertcommon.ReadCWT(cwt)
+	if err != nil || hcert.DCC == nil {
+		return STATEMENT_TYPE_UNKNOWN, STATEMENT_TYPE_UNKNOWN
+	}
+
+	return hcert.Issuer, dccStatementTypes(hcert.DCC)
+}
+
+// dccStatementTypes joins the types of the statements in a DCC, like vaccination+recovery
+func dccStatementTypes(dcc *hcertcommon.DCC) string {
+	var statementTypes []string
+	if len(dcc.Vaccinations) > 0 {
+		statementTypes = append(statementTypes, mobilecore.DCC_STATEMENT_VACCINATION)
+	}
+
+	if len(dcc.Tests) > 0 {
+		statementTypes = append(statementTypes, mobilecore.DCC_STATEMENT_TEST)
+	}
+
+	if len(dcc.Recoveries) > 0 {
+		statementTypes = append(statementTypes, mobilecore.DCC_STATEMENT_RECOVERY)
+	}
+
+	if len(statementTypes) == 0 {
+		return STATEMENT_TYPE_UNKNOWN
+	}
+
+	return strings.Join(statementTypes, "+")
+}
+
+// dccCountry returns the country of the first statement, which is used as issuer of an unsigned DCC payload
+func dccCountry(dcc *hcertcommon.DCC) string {
+	for _, vacc := range dcc.Vaccinations {
+		return vacc.CountryOfVaccination
+	}
+
+	for _, test := range dcc.Tests {
+		return test.CountryOfVaccination
+	}
+
+	for _, rec := range dcc.Recoveries {
+		return rec.CountryOfTest
+	}
+
+	return ""
+}
+
+func (summary *compareSummary) count(input *compareInput, oldOutcome, newOutcome *compareOutcome) {
+	for _, counts := range []*compareCounts{
+		&summary.compareCounts,
+		countsGroup(summary.PerIssuerCountry, input.issuerCountry),
+		countsGroup(summary.PerStatementType, input.statementType),
+	} {
+		counts.Total++
+		if *oldOutcome == *newOutcome {
+			continue
+		}
+
+		counts.Changed++
+		if newOutcome.Status == statusNames[mobilecore.VERIFICATION_SUCCESS] {
+			counts.NewlyAccepted++
+		} else if oldOutcome.Status == statusNames[mobilecore.VERIFICATION_SUCCESS] {
+			counts.NewlyRejected++
+		}
+	}
+}
+
+func countsGroup(groups map[string]*compareCounts, name string) *compareCounts {
+	counts, ok := groups[name]
+	if !ok {
+		counts = &compareCounts{}
+		groups[name] = counts
+	}
+
+	return counts
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	mobilecore "github.com/minvws/nl-covid19-coronacheck-mobile-core"
+	"github.com/minvws/nl-covid19-coronacheck-mobile-core/dccissuer"
+	"github.com/minvws/nl-covid19-coronacheck-mobile-core/fixtures"
+	"github.com/minvws/nl-covid19-coronacheck-mobile-core/fixtures/configdir"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompareConfigs(t *testing.T) {
+	// Restore the testdata config for the other tests
+	defer mobilecore.InitializeVerifier("../testdata")
+
+	now := time.Now()
+
+	// Two configs that only differ in the validity of tests
+	defaultConfigPath, shortTestsConfigPath := t.TempDir(), t.TempDir()
+	err := configdir.Write(defaultConfigPath, "../testdata", nil, nil)
+	if err != nil {
+		t.Fatal("Could not write config:", err)
+	}
+
+	err = configdir.Write(shortTestsConfigPath, "../testdata", func(config map[string]interface{}) {
+		config["europeanVerificationRules"].(map[string]interface{})["testValidityHours"] = 1
+	}, nil)
+	if err != nil {
+		t.Fatal("Could not write config:", err)
+	}
+
+	// A domestic QR that is accepted by both configs, and an unsigned test DCC that is only accepted
+	//  by the default config
+	qr, err := fixtures.IssueDomestic(&fixtures.DomesticSpecification{
+		KeyIdentifier:    fixtures.TEST_KEY_IDENTIFIER,
+		PkPath:           "../testdata/pk.xml",
+		SkPath:           "../testdata/sk.xml",
+		Attributes:       fixtures.DefaultDomesticAttributes(now),
+		DisclosurePolicy: mobilecore.DISCLOSURE_POLICY_3G,
+		DisclosedAt:      now,
+	})
+	if err != nil {
+		t.Fatal("Could not issue domestic QR:", err)
+	}
+
+	dcc := dccissuer.NewDCC("Bouwer", "Bob", "1990-01-01")
+	dcc.Tests = append(dcc.Tests, dccissuer.NewTest("DE", dccissuer.TEST_TYPE_NAAT, "", now.Add(-2*time.Hour)))
+	dccLine, err := json.Marshal(&compareInput{Id: "test", DCC: dcc})
+	if err != nil {
+		t.Fatal("Could not JSON marshal DCC input:", err)
+	}
+
+	inputPath := filepath.Join(t.TempDir(), "input.txt")
+	err = os.WriteFile(inputPath, []byte(string(qr)+"\n"+string(dccLine)+"\n"), 0644)
+	if err != nil {
+		t.Fatal("Could not write input:", err)
+	}
+
+	testCases := []struct {
+		oldConfigPath, newConfigPath string
+		oldStatus, newStatus         string
+		newlyAccepted, newlyRejected int
+	}{
+		{defaultConfigPath, shortTestsConfigPath, "success", "error", 0, 1},
+		{shortTestsConfigPath, defaultConfigPath, "error", "success", 1, 0},
+	}
+
+	for i, testCase := range testCases {
+		output := &bytes.Buffer{}
+		err = runCompareConfigs(testCase.oldConfigPath, testCase.newConfigPath, inputPath, fmt.Sprint(now.Unix()), "3G", output)
+		if err != nil {
+			t.Fatal("Could not compare configs:", i, err)
+		}
+
+		lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+		if len(lines) != 2 {
+			t.Fatal("Expected a single change and the summary:", i, output.String())
+		}
+
+		change := &compareChange{}
+		err = json.Unmarshal([]byte(lines[0]), change)
+		if err != nil {
+			t.Fatal("Could not JSON unmarshal change:", i, err)
+		}
+
+		if change.Id != "test" || change.Policy != "3G" || change.Timestamp != now.Unix() ||
+			change.IssuerCountry != "DE" || change.StatementType != mobilecore.DCC_STATEMENT_TEST {
+			t.Fatal("Unexpected change:", i, lines[0])
+		}
+
+		if change.Old.Status != testCase.oldStatus || change.New.Status != testCase.newStatus {
+			t.Fatal("Unexpected outcomes:", i, change.Old.Status, change.New.Status)
+		}
+
+		var summaryLine map[string]*compareSummary
+		err = json.Unmarshal([]byte(lines[1]), &summaryLine)
+		if err != nil {
+			t.Fatal("Could not JSON unmarshal summary:", i, err)
+		}
+
+		summary := summaryLine["summary"]
+		changedCounts := compareCounts{Total: 1, Changed: 1, NewlyAccepted: testCase.newlyAccepted, NewlyRejected: testCase.newlyRejected}
+		unchangedCounts := compareCounts{Total: 1}
+
+		if summary == nil || summary.compareCounts != (compareCounts{Total: 2, Changed: 1, NewlyAccepted: testCase.newlyAccepted, NewlyRejected: testCase.newlyRejected}) {
+			t.Fatal("Unexpected summary:", i, lines[1])
+		}
+
+		if len(summary.PerIssuerCountry) != 2 || *summary.PerIssuerCountry["DE"] != changedCounts || *summary.PerIssuerCountry["NL"] != unchangedCounts {
+			t.Fatal("Unexpected counts per issuer country:", i, lines[1])
+		}
+
+		if len(summary.PerStatementType) != 2 || *summary.PerStatementType[mobilecore.DCC_STATEMENT_TEST] != changedCounts ||
+			*summary.PerStatementType[STATEMENT_TYPE_DOMESTIC] != unchangedCounts {
+			t.Fatal("Unexpected counts per statement type:", i, lines[1])
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/minvws/nl-covid19-coronacheck-mobile-core/qrimage"
+	"os"
+)
+
+// collectQRs returns the QR given as argument, or the QRs decoded from the given image path
+func collectQRs(flags *flag.FlagSet, imagePath string) ([]*qrimage.DecodedQR, error) {
+	if imagePath == "" {
+		qr := flags.Arg(0)
+		if len(qr) == 0 {
+			return nil, errors.Errorf("No QR was given")
+		}
+
+		return []*qrimage.DecodedQR{{Content: qr}}, nil
+	}
+
+	qrs, err := qrimage.DecodePath(imagePath)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not decode QRs from image", 0)
+	}
+
+	if len(qrs) == 0 {
+		return nil, errors.Errorf("No images with QRs were found")
+	}
+
+	return qrs, nil
+}
+
+// forEachQR runs the function for every QR, where QRs from images are reported individually
+//  and a failure, including an image that couldn't be decoded, doesn't stop the others from being handled
+func forEachQR(qrs []*qrimage.DecodedQR, run func(qr string) error) error {
+	if len(qrs) == 1 && qrs[0].Path == "" {
+		return run(qrs[0].Content)
+	}
+
+	failedAmount := 0
+	for _, qr := range qrs {
+		if qr.Error != "" {
+			_, _ = fmt.Fprintln(os.Stderr, "\nCould not decode image:", qr.Error)
+			failedAmount++
+			continue
+		}
+
+		fmt.Printf("\nQR %d in %s:\n", qr.Index, qr.Path)
+
+		err := run(qr.Content)
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err.Error())
+			failedAmount++
+		}
+	}
+
+	if failedAmount > 0 {
+		return errors.Errorf("%d of %d QRs or images failed", failedAmount, len(qrs))
+	}
+
+	return nil
+}
+
+// runDecode writes the QRs in the given images as JSON lines, which can be used as verify-batch input
+func runDecode(decodeFlags *flag.FlagSet) error {
+	imagePath := decodeFlags.Arg(0)
+	if imagePath == "" {
+		return errors.Errorf("No image file or directory was given")
+	}
+
+	qrs, err := qrimage.DecodePath(imagePath)
+	if err != nil {
+		return errors.WrapPrefix(err, "Could not decode QRs from image", 0)
+	}
+
+	// Images that couldn't be decoded are reported after the QRs of the others are written
+	failedAmount := 0
+	encoder := json.NewEncoder(os.Stdout)
+	for _, qr := range qrs {
+		if qr.Error != "" {
+			_, _ = fmt.Fprintln(os.Stderr, "Could not decode image:", qr.Error)
+			failedAmount++
+			continue
+		}
+
+		err = encoder.Encode(&batchInput{
+			Id: fmt.Sprintf("%s#%d", qr.Path, qr.Index),
+			QR: qr.Content,
+		})
+		if err != nil {
+			return errors.WrapPrefix(err, "Could not write decoded QR", 0)
+		}
+	}
+
+	if failedAmount > 0 {
+		return errors.Errorf("%d images could not be decoded", failedAmount)
+	}
+
+	return nil
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/go-errors/errors"
+	hcertcommon "github.com/minvws/nl-covid19-coronacheck-hcert/common"
+	hcertverifier "github.com/minvws/nl-covid19-coronacheck-hcert/verifier"
+	"github.com/minvws/nl-covid19-coronacheck-mobile-core/dccissuer"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	STATEMENT_TYPE_VACCINATION = "vaccination"
+	STATEMENT_TYPE_TEST        = "test"
+	STATEMENT_TYPE_RECOVERY    = "recovery"
+)
+
+type issueDCCOptions struct {
+	dccPath *string
+
+	statementType    *string
+	familyName       *string
+	givenName        *string
+	dateOfBirth      *string
+	country          *string
+	date             *string
+	doseNumber       *int
+	totalDoses       *int
+	medicinalProduct *string
+	testType         *string
+	testManufacturer *string
+
+	issuer    *string
+	issuedAt  *int64
+	expiresAt *int64
+
+	keyPath        *string
+	keyType        *string
+	writeKeyPath   *string
+	san            *string
+	keyUsage       *string
+	publicKeysPath *string
+}
+
+func newIssueDCCOptions(issueDCCFlags *flag.FlagSet) *issueDCCOptions {
+	return &issueDCCOptions{
+		dccPath: issueDCCFlags.String("dcc", "", "JSON file with the DCC to issue, or - for stdin, instead of building it from the flags"),
+
+		statementType:    issueDCCFlags.String("type", STATEMENT_TYPE_VACCINATION, "Statement to issue: vaccination, test or recovery"),
+		familyName:       issueDCCFlags.String("familyname", "Bouwer", "Family name of the holder"),
+		givenName:        issueDCCFlags.String("givenname", "Bob", "Given name of the holder"),
+		dateOfBirth:      issueDCCFlags.String("dob", "1960-01-01", "(Partial) date of birth of the holder"),
+		country:          issueDCCFlags.String("country", "NL", "Country of the statement"),
+		date:             issueDCCFlags.String("date", "", "Date of vaccination or first positive test as YYYY-MM-DD, or time of test collection as RFC 3339. Defaults to 30 days, or for tests one hour, before issuance"),
+		doseNumber:       issueDCCFlags.Int("dosenumber", 2, "Dose number of the vaccination"),
+		totalDoses:       issueDCCFlags.Int("totaldoses", 2, "Total series of doses of the vaccination"),
+		medicinalProduct: issueDCCFlags.String("product", "", "Medicinal product of the vaccination, which defaults to "+dccissuer.DEFAULT_MEDICINAL_PRODUCT),
+		testType:         issueDCCFlags.String("testtype", "", "Type of test, which defaults to NAAT"),
+		testManufacturer: issueDCCFlags.String("testmanufacturer", "", "Test name and manufacturer of a rapid antigen test"),
+
+		issuer:    issueDCCFlags.String("issuer", "", "Issuer of the CWT, which defaults to the country"),
+		issuedAt:  issueDCCFlags.Int64("issuedat", time.Now().Unix(), "Issuance timestamp of the CWT"),
+		expiresAt: issueDCCFlags.Int64("expiresat", 0, "Expiration timestamp of the CWT, which defaults to one year after issuance"),
+
+		keyPath:        issueDCCFlags.String("key", "", "PEM file with the ECDSA or RSA signing key. A new key is generated when not given"),
+		keyType:        issueDCCFlags.String("keytype", dccissuer.KEY_TYPE_ECDSA, "Type of key to generate: ecdsa or rsa"),
+		writeKeyPath:   issueDCCFlags.String("writekey", "", "PEM file to write a generated signing key to"),
+		san:            issueDCCFlags.String("san", "", "Subject alternative name of the public key entry"),
+		keyUsage:       issueDCCFlags.String("keyusage", "", "Comma separated key usage of the public key entry, like v,t,r"),
+		publicKeysPath: issueDCCFlags.String("publickeys", "", "public_keys.json file to add the public key entry to. The entry is printed to stderr when not given"),
+	}
+}
+
+func runIssueDCC(options *issueDCCOptions) error {
+	var keyUsage []string
+	if *options.keyUsage != "" {
+		keyUsage = strings.Split(*options.keyUsage, ",")
+	}
+
+	key, err := loadOrGenerateSigningKey(options, keyUsage)
+	if err != nil {
+		return err
+	}
+
+	issuedAt := time.Unix(*options.issuedAt, 0)
+	dcc, err := buildDCC(options, issuedAt)
+	if err != nil {
+		return err
+	}
+
+	issuer := *options.issuer
+	if issuer == "" {
+		issuer = *options.country
+	}
+
+	expiresAt := *options.expiresAt
+	if expiresAt == 0 {
+		expiresAt = issuedAt.AddDate(1, 0, 0).Unix()
+	}
+
+	qr, err := dccissuer.Issue(key, &dccissuer.Specification{
+		Issuer:         issuer,
+		IssuedAt:       issuedAt.Unix(),
+		ExpirationTime: expiresAt,
+		DCC:            dcc,
+	})
+	if err != nil {
+		return errors.WrapPrefix(err, "Could not issue DCC", 0)
+	}
+
+	// Make the signing key known to the verifier
+	if *options.publicKeysPath != "" {
+		err = key.AddToPublicKeysFile(*options.publicKeysPath)
+		if err != nil {
+			return err
+		}
+	} else {
+		entry, err := key.PublicKeyEntry()
+		if err != nil {
+			return err
+		}
+
+		entryJson, err := json.Marshal(map[string][]*hcertverifier.AnnotatedEuropeanPk{key.KIDB64(): {entry}})
+		if err != nil {
+			return errors.WrapPrefix(err, "Could not JSON marshal public key entry", 0)
+		}
+
+		_, _ = fmt.Fprintf(os.Stderr, "Public key entry: %s\n", entryJson)
+	}
+
+	fmt.Println(string(qr))
+	return nil
+}
+
+func loadOrGenerateSigningKey(options *issueDCCOptions, keyUsage []string) (*dccissuer.SigningKey, error) {
+	if *options.keyPath != "" {
+		return dccissuer.LoadSigningKeyFile(*options.keyPath, *options.san, keyUsage)
+	}
+
+	key, err := dccissuer.GenerateSigningKey(*options.keyType, *options.san, keyUsage)
+	if err != nil {
+		return nil, err
+	}
+
+	if *options.writeKeyPath != "" {
+		err = key.WriteFile(*options.writeKeyPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return key, nil
+}
+
+// buildDCC reads the DCC from JSON when a path is given, and builds it from the flags otherwise
+func buildDCC(options *issueDCCOptions, issuedAt time.Time) (*hcertcommon.DCC, error) {
+	if *options.dccPath != "" {
+		return readDCCJson(*options.dccPath)
+	}
+
+	country := *options.country
+	dcc := dccissuer.NewDCC(*options.familyName, *options.givenName, *options.dateOfBirth)
+
+	date := *options.date
+	if date == "" && *options.statementType != STATEMENT_TYPE_TEST {
+		date = issuedAt.AddDate(0, 0, -30).UTC().Format(dccissuer.YYYYMMDD_FORMAT)
+	}
+
+	switch *options.statementType {
+	case STATEMENT_TYPE_VACCINATION:
+		vacc := dccissuer.NewVaccination(country, *options.medicinalProduct, *options.doseNumber, *options.totalDoses, date)
+		dcc.Vaccinations = append(dcc.Vaccinations, vacc)
+	case STATEMENT_TYPE_TEST:
+		timeOfCollection := issuedAt.Add(-time.Hour)
+		if date != "" {
+			var err error
+			timeOfCollection, err = time.Parse(time.RFC3339, date)
+			if err != nil {
+				return nil, errors.WrapPrefix(err, "Could not parse time of test collection", 0)
+			}
+		}
+
+		test := dccissuer.NewTest(country, *options.testType, *options.testManufacturer, timeOfCollection)
+		dcc.Tests = append(dcc.Tests, test)
+	case STATEMENT_TYPE_RECOVERY:
+		rec, err := dccissuer.NewRecovery(country, date)
+		if err != nil {
+			return nil, err
+		}
+
+		dcc.Recoveries = append(dcc.Recoveries, rec)
+	default:
+		return nil, errors.Errorf("Unrecognized statement type. Allowed values are: vaccination, test, recovery")
+	}
+
+	return dcc, nil
+}
+
+func readDCCJson(path string) (*hcertcommon.DCC, error) {
+	var dccJson []byte
+	var err error
+	if path == "-" {
+		dccJson, err = io.ReadAll(os.Stdin)
+	} else {
+		dccJson, err = os.ReadFile(path)
+	}
+
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not read DCC file", 0)
+	}
+
+	var dcc *hcertcommon.DCC
+	err = json.Unmarshal(dccJson, &dcc)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not JSON unmarshal DCC", 0)
+	}
+
+	if dcc == nil || dcc.Name == nil {
+		return nil, errors.Errorf("The DCC has no name")
+	}
+
+	return dcc, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/go-errors/errors"
+	mobilecore "github.com/minvws/nl-covid19-coronacheck-mobile-core"
+	"github.com/minvws/nl-covid19-coronacheck-mobile-core/fixtures"
+	"strconv"
+	"time"
+)
+
+var disclosurePolicies = map[string]string{
+	"1G": mobilecore.DISCLOSURE_POLICY_1G,
+	"3G": mobilecore.DISCLOSURE_POLICY_3G,
+}
+
+type issueDomesticOptions struct {
+	keyIdentifier *string
+	pkPath        *string
+	skPath        *string
+
+	timestamp        *int64
+	disclosurePolicy *string
+
+	category         *string
+	validFrom        *int64
+	validForHours    *int
+	isPaperProof     *bool
+	isSpecimen       *bool
+	firstNameInitial *string
+	lastNameInitial  *string
+	birthDay         *string
+	birthMonth       *string
+}
+
+func newIssueDomesticOptions(issueDomesticFlags *flag.FlagSet) *issueDomesticOptions {
+	return &issueDomesticOptions{
+		keyIdentifier: issueDomesticFlags.String("kid", fixtures.TEST_KEY_IDENTIFIER, "Key identifier of the issuer key pair in the public keys config"),
+		pkPath:        issueDomesticFlags.String("pk", fixtures.TEST_PK_PATH, "Issuer public key XML file"),
+		skPath:        issueDomesticFlags.String("sk", fixtures.TEST_SK_PATH, "Issuer secret key XML file"),
+
+		timestamp:        issueDomesticFlags.Int64("timestamp", time.Now().Unix(), "Timestamp of disclosure to use"),
+		disclosurePolicy: issueDomesticFlags.String("disclosurepolicy", "3G", "Disclosure policy to use, which is ignored for paper proofs"),
+
+		category:         issueDomesticFlags.String("category", mobilecore.CATEGORY_ATTRIBUTE_1G, "Category attribute"),
+		validFrom:        issueDomesticFlags.Int64("validfrom", 0, "Valid from timestamp, which defaults to the start of the hour of disclosure"),
+		validForHours:    issueDomesticFlags.Int("validforhours", 24, "Hours the credential is valid for"),
+		isPaperProof:     issueDomesticFlags.Bool("ispaperproof", false, "Issue a paper proof"),
+		isSpecimen:       issueDomesticFlags.Bool("isspecimen", false, "Issue a specimen"),
+		firstNameInitial: issueDomesticFlags.String("firstnameinitial", "B", "First name initial"),
+		lastNameInitial:  issueDomesticFlags.String("lastnameinitial", "B", "Last name initial"),
+		birthDay:         issueDomesticFlags.String("birthday", "01", "Birth day, or an empty value when unknown"),
+		birthMonth:       issueDomesticFlags.String("birthmonth", "01", "Birth month, or an empty value when unknown"),
+	}
+}
+
+func runIssueDomestic(options *issueDomesticOptions) error {
+	disclosurePolicy, ok := disclosurePolicies[*options.disclosurePolicy]
+	if !ok {
+		return errors.Errorf("Unrecognized disclosure policy. Allowed values are: 1G, 3G")
+	}
+
+	disclosedAt := time.Unix(*options.timestamp, 0)
+	attributes := fixtures.DefaultDomesticAttributes(disclosedAt)
+	attributes["category"] = *options.category
+	attributes["validForHours"] = strconv.Itoa(*options.validForHours)
+	attributes["isPaperProof"] = boolAttribute(*options.isPaperProof)
+	attributes["isSpecimen"] = boolAttribute(*options.isSpecimen)
+	attributes["firstNameInitial"] = *options.firstNameInitial
+	attributes["lastNameInitial"] = *options.lastNameInitial
+	attributes["birthDay"] = *options.birthDay
+	attributes["birthMonth"] = *options.birthMonth
+
+	if *options.validFrom != 0 {
+		attributes["validFrom"] = strconv.FormatInt(*options.validFrom, 10)
+	}
+
+	qr, err := fixtures.IssueDomestic(&fixtures.DomesticSpecification{
+		KeyIdentifier:    *options.keyIdentifier,
+		PkPath:           *options.pkPath,
+		SkPath:           *options.skPath,
+		Attributes:       attributes,
+		DisclosurePolicy: disclosurePolicy,
+		DisclosedAt:      disclosedAt,
+	})
+	if err != nil {
+		return errors.WrapPrefix(err, "Could not issue domestic QR", 0)
+	}
+
+	fmt.Println(string(qr))
+	return nil
+}
+
+func boolAttribute(value bool) string {
+	if value {
+		return "1"
+	}
+
+	return "0"
+}
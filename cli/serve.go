@@ -0,0 +1,296 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-errors/errors"
+	hcertcommon "github.com/minvws/nl-covid19-coronacheck-hcert/common"
+	idemixcommon "github.com/minvws/nl-covid19-coronacheck-idemix/common"
+	mobilecore "github.com/minvws/nl-covid19-coronacheck-mobile-core"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	QR_TYPE_DOMESTIC     = "domestic"
+	QR_TYPE_NL_DCC       = "nlDCC"
+	QR_TYPE_FOREIGN_DCC  = "foreignDCC"
+	QR_TYPE_UNRECOGNIZED = "unrecognized"
+)
+
+// serveRequest is the JSON body of the verify, explain and classify endpoints, where the policy
+//  and timestamp are optional and default to 3G and the current time
+type serveRequest struct {
+	QR        string `json:"qr"`
+	Policy    string `json:"policy"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+type classifyResponse struct {
+	Type string `json:"type"`
+}
+
+type healthResponse struct {
+	Status     string `json:"status"`
+	ConfigPath string `json:"configPath"`
+	LoadedAt   int64  `json:"loadedAt"`
+}
+
+// verificationServer serializes config reloads with requests, as the verifier and holder state is global
+type verificationServer struct {
+	mutex      sync.RWMutex
+	configPath string
+	loadedAt   time.Time
+
+	// snapshotPath is a copy of the config directory that was loaded last, which is loaded again
+	//  when only part of a reload succeeds
+	snapshotPath string
+}
+
+func runServe(configPath string, address string) error {
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		return errors.Errorf("Config directory '%s' does not exist\n", configPath)
+	}
+
+	server := &verificationServer{configPath: configPath}
+	defer server.close()
+
+	err := server.reload()
+	if err != nil {
+		return err
+	}
+
+	// Reload the config directory on SIGHUP, and keep serving with the previous config if that fails
+	reloadSignals := make(chan os.Signal, 1)
+	signal.Notify(reloadSignals, syscall.SIGHUP)
+	go server.reloadOnSignals(reloadSignals, func(err error) {
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, "Could not reload config:", err.Error())
+			return
+		}
+
+		_, _ = fmt.Fprintln(os.Stderr, "Reloaded config from", configPath)
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", server.handleHealth)
+	mux.HandleFunc("/verify", server.handleVerify)
+	mux.HandleFunc("/explain", server.handleExplain)
+	mux.HandleFunc("/classify", server.handleClassify)
+
+	_, _ = fmt.Fprintln(os.Stderr, "Serving on", address)
+	return http.ListenAndServe(address, mux)
+}
+
+func (server *verificationServer) reloadOnSignals(signals <-chan os.Signal, reloaded func(err error)) {
+	for range signals {
+		reloaded(server.reload())
+	}
+}
+
+// reload initializes the verifier and holder from a snapshot of the config directory, and initializes
+//  both from the previous snapshot again when either fails, so they never use different configs
+func (server *verificationServer) reload() error {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	snapshotPath, err := snapshotConfigDirectory(server.configPath)
+	if err != nil {
+		return err
+	}
+
+	err = initializeFromConfigDirectory(snapshotPath)
+	if err != nil {
+		_ = os.RemoveAll(snapshotPath)
+		if server.snapshotPath == "" {
+			return err
+		}
+
+		rollbackErr := initializeFromConfigDirectory(server.snapshotPath)
+		if rollbackErr != nil {
+			return errors.Errorf("%s, and could not roll back to the previous config: %s", err.Error(), rollbackErr.Error())
+		}
+
+		return err
+	}
+
+	server.close()
+	server.snapshotPath = snapshotPath
+	server.loadedAt = time.Now()
+	return nil
+}
+
+func (server *verificationServer) close() {
+	if server.snapshotPath != "" {
+		_ = os.RemoveAll(server.snapshotPath)
+	}
+}
+
+func initializeFromConfigDirectory(configPath string) error {
+	initializeResult := mobilecore.InitializeVerifier(configPath)
+	if initializeResult.Error != "" {
+		return errors.Errorf("Could not initialize verifier: %s", initializeResult.Error)
+	}
+
+	// The holder is used to explain and classify DCCs
+	initializeResult = mobilecore.InitializeHolder(configPath)
+	if initializeResult.Error != "" {
+		return errors.Errorf("Could not initialize holder: %s", initializeResult.Error)
+	}
+
+	return nil
+}
+
+// snapshotConfigDirectory copies the verifier and holder config files to a temporary directory, so
+//  the config that was loaded can be loaded again after the config directory has changed
+func snapshotConfigDirectory(configPath string) (string, error) {
+	snapshotPath, err := os.MkdirTemp("", "mobilecore-serve-")
+	if err != nil {
+		return "", errors.WrapPrefix(err, "Could not create config snapshot directory", 0)
+	}
+
+	// The verifier and holder may share files, which are then simply copied twice
+	filenames := []string{
+		mobilecore.VERIFIER_CONFIG_FILENAME,
+		mobilecore.VERIFIER_PUBLIC_KEYS_FILENAME,
+		mobilecore.HOLDER_CONFIG_FILENAME,
+		mobilecore.HOLDER_PUBLIC_KEYS_FILENAME,
+	}
+
+	for _, filename := range filenames {
+		content, err := os.ReadFile(path.Join(configPath, filename))
+		if err != nil {
+			_ = os.RemoveAll(snapshotPath)
+			return "", errors.WrapPrefix(err, "Could not read config file", 0)
+		}
+
+		err = os.WriteFile(path.Join(snapshotPath, filename), content, 0600)
+		if err != nil {
+			_ = os.RemoveAll(snapshotPath)
+			return "", errors.WrapPrefix(err, "Could not write config snapshot file", 0)
+		}
+	}
+
+	return snapshotPath, nil
+}
+
+func (server *verificationServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	server.mutex.RLock()
+	defer server.mutex.RUnlock()
+
+	writeJson(w, http.StatusOK, &healthResponse{
+		Status:     "ok",
+		ConfigPath: server.configPath,
+		LoadedAt:   server.loadedAt.Unix(),
+	})
+}
+
+func (server *verificationServer) handleVerify(w http.ResponseWriter, r *http.Request) {
+	request, ok := readServeRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if request.Policy == "" {
+		request.Policy = "3G"
+	}
+
+	if _, ok := policies[request.Policy]; !ok {
+		writeError(w, http.StatusBadRequest, "Unrecognized verification policy. Allowed values are: 1G, 3G")
+		return
+	}
+
+	server.mutex.RLock()
+	defer server.mutex.RUnlock()
+
+	input := &batchInput{QR: request.QR, Timestamp: request.Timestamp}
+	writeJson(w, http.StatusOK, verifyBatchInput(input, request.Policy))
+}
+
+func (server *verificationServer) handleExplain(w http.ResponseWriter, r *http.Request) {
+	request, ok := readServeRequest(w, r)
+	if !ok {
+		return
+	}
+
+	server.mutex.RLock()
+	defer server.mutex.RUnlock()
+
+	explainResult := mobilecore.ExplainForeignDCCWithTime([]byte(request.QR), request.Timestamp)
+	if explainResult.Error != "" {
+		writeError(w, http.StatusUnprocessableEntity, explainResult.Error)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(explainResult.Value)
+}
+
+func (server *verificationServer) handleClassify(w http.ResponseWriter, r *http.Request) {
+	request, ok := readServeRequest(w, r)
+	if !ok {
+		return
+	}
+
+	server.mutex.RLock()
+	defer server.mutex.RUnlock()
+
+	writeJson(w, http.StatusOK, &classifyResponse{Type: classifyQR([]byte(request.QR))})
+}
+
+func classifyQR(qr []byte) string {
+	if idemixcommon.HasNLPrefix(qr) {
+		return QR_TYPE_DOMESTIC
+	}
+
+	if !hcertcommon.HasEUPrefix(qr) || !mobilecore.IsDCC(qr) {
+		return QR_TYPE_UNRECOGNIZED
+	}
+
+	if mobilecore.IsForeignDCC(qr) {
+		return QR_TYPE_FOREIGN_DCC
+	}
+
+	return QR_TYPE_NL_DCC
+}
+
+// readServeRequest reads the JSON body of a POST request, and writes an error response if that fails
+func readServeRequest(w http.ResponseWriter, r *http.Request) (*serveRequest, bool) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Only POST requests are allowed")
+		return nil, false
+	}
+
+	request := &serveRequest{}
+	err := json.NewDecoder(r.Body).Decode(request)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Could not JSON unmarshal request: "+err.Error())
+		return nil, false
+	}
+
+	if request.QR == "" {
+		writeError(w, http.StatusBadRequest, "No QR was given")
+		return nil, false
+	}
+
+	if request.Timestamp == 0 {
+		request.Timestamp = time.Now().Unix()
+	}
+
+	return request, true
+}
+
+func writeJson(w http.ResponseWriter, statusCode int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, statusCode int, message string) {
+	writeJson(w, statusCode, map[string]string{"error": message})
+}
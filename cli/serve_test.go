@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	mobilecore "github.com/minvws/nl-covid19-coronacheck-mobile-core"
+	"github.com/minvws/nl-covid19-coronacheck-mobile-core/fixtures"
+	"github.com/minvws/nl-covid19-coronacheck-mobile-core/fixtures/configdir"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestServeReloadWithBrokenConfig(t *testing.T) {
+	configPath := t.TempDir()
+	err := configdir.Write(configPath, "../testdata", nil, nil)
+	if err != nil {
+		t.Fatal("Could not write config:", err)
+	}
+
+	server := &verificationServer{configPath: configPath}
+	defer server.close()
+
+	err = server.reload()
+	if err != nil {
+		t.Fatal("Could not load config:", err)
+	}
+
+	loadedAt := server.loadedAt
+	qr, err := fixtures.IssueDomestic(&fixtures.DomesticSpecification{
+		KeyIdentifier:    fixtures.TEST_KEY_IDENTIFIER,
+		PkPath:           "../testdata/pk.xml",
+		SkPath:           "../testdata/sk.xml",
+		Attributes:       fixtures.DefaultDomesticAttributes(time.Now()),
+		DisclosurePolicy: mobilecore.DISCLOSURE_POLICY_3G,
+		DisclosedAt:      time.Now(),
+	})
+	if err != nil {
+		t.Fatal("Could not issue domestic QR:", err)
+	}
+
+	if status := serveVerifyStatus(t, server, qr); status != "success" {
+		t.Fatal("Expected the QR to verify with the initial config, but got", status)
+	}
+
+	// A config that denylists the QR, but can't be loaded because the public keys are broken
+	domesticVerifier, _ := mobilecore.GetVerifiersForCLI()
+	verifiedCred, err := domesticVerifier.VerifyQREncoded(qr)
+	if err != nil {
+		t.Fatal("Could not verify domestic QR:", err)
+	}
+
+	proofIdentifier := base64.StdEncoding.EncodeToString(verifiedCred.ProofIdentifier)
+	denylistQR := func(config map[string]interface{}) {
+		rules := config["domesticVerificationRules"].(map[string]interface{})
+		rules["proofIdentifierDenylist"] = map[string]bool{proofIdentifier: true}
+	}
+
+	err = configdir.Write(configPath, "../testdata", denylistQR, []byte("{"))
+	if err != nil {
+		t.Fatal("Could not write config:", err)
+	}
+
+	reloadSignals := make(chan os.Signal, 1)
+	signal.Notify(reloadSignals, syscall.SIGHUP)
+	defer signal.Stop(reloadSignals)
+
+	reloadErrs := make(chan error)
+	go server.reloadOnSignals(reloadSignals, func(err error) {
+		reloadErrs <- err
+	})
+
+	if err := sendReloadSignal(t, reloadErrs); err == nil {
+		t.Fatal("Expected reloading the broken config to fail")
+	}
+
+	// The previous config should still be used, without any of the broken config
+	if server.loadedAt != loadedAt {
+		t.Fatal("The load time should not change when reloading fails")
+	}
+
+	if status := serveVerifyStatus(t, server, qr); status != "success" {
+		t.Fatal("Expected the QR to verify with the previous config, but got", status)
+	}
+
+	// After the config is fixed, reloading should apply the denylist
+	err = configdir.Write(configPath, "../testdata", denylistQR, nil)
+	if err != nil {
+		t.Fatal("Could not write config:", err)
+	}
+	if err := sendReloadSignal(t, reloadErrs); err != nil {
+		t.Fatal("Could not reload the fixed config:", err)
+	}
+
+	if status := serveVerifyStatus(t, server, qr); status == "success" {
+		t.Fatal("Expected the QR to be denied with the reloaded config")
+	}
+}
+
+func TestServeConcurrentVerify(t *testing.T) {
+	configPath := t.TempDir()
+	err := configdir.Write(configPath, "../testdata", nil, nil)
+	if err != nil {
+		t.Fatal("Could not write config:", err)
+	}
+
+	server := &verificationServer{configPath: configPath}
+	defer server.close()
+
+	qr, err := fixtures.IssueDomestic(&fixtures.DomesticSpecification{
+		KeyIdentifier:    fixtures.TEST_KEY_IDENTIFIER,
+		PkPath:           "../testdata/pk.xml",
+		SkPath:           "../testdata/sk.xml",
+		Attributes:       fixtures.DefaultDomesticAttributes(time.Now()),
+		DisclosurePolicy: mobilecore.DISCLOSURE_POLICY_3G,
+		DisclosedAt:      time.Now(),
+	})
+	if err != nil {
+		t.Fatal("Could not issue domestic QR:", err)
+	}
+
+	requestJson, err := json.Marshal(&serveRequest{QR: string(qr)})
+	if err != nil {
+		t.Fatal("Could not JSON marshal request:", err)
+	}
+
+	// The first verifications after a reload load the issuer public key at the same time
+	err = server.reload()
+	if err != nil {
+		t.Fatal("Could not load config:", err)
+	}
+
+	recorders := make([]*httptest.ResponseRecorder, 8)
+	wg := sync.WaitGroup{}
+	for i := range recorders {
+		recorders[i] = httptest.NewRecorder()
+
+		wg.Add(1)
+		go func(recorder *httptest.ResponseRecorder) {
+			defer wg.Done()
+			server.handleVerify(recorder, httptest.NewRequest(http.MethodPost, "/verify", bytes.NewReader(requestJson)))
+		}(recorders[i])
+	}
+
+	wg.Wait()
+
+	for i, recorder := range recorders {
+		result := &batchResult{}
+		err = json.Unmarshal(recorder.Body.Bytes(), result)
+		if err != nil || result.Status != "success" {
+			t.Fatal("Could not verify concurrently", i, result.Status, result.Error)
+		}
+	}
+}
+
+func sendReloadSignal(t *testing.T, reloadErrs <-chan error) error {
+	err := syscall.Kill(os.Getpid(), syscall.SIGHUP)
+	if err != nil {
+		t.Fatal("Could not send reload signal:", err)
+	}
+
+	select {
+	case err := <-reloadErrs:
+		return err
+	case <-time.After(10 * time.Second):
+		t.Fatal("The config was not reloaded after the signal")
+		return nil
+	}
+}
+
+func serveVerifyStatus(t *testing.T, server *verificationServer, qr []byte) string {
+	requestJson, err := json.Marshal(&serveRequest{QR: string(qr)})
+	if err != nil {
+		t.Fatal("Could not JSON marshal request:", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	server.handleVerify(recorder, httptest.NewRequest(http.MethodPost, "/verify", bytes.NewReader(requestJson)))
+
+	result := &batchResult{}
+	err = json.Unmarshal(recorder.Body.Bytes(), result)
+	if err != nil {
+		t.Fatal("Could not JSON unmarshal verify response:", err)
+	}
+
+	return result.Status
+}
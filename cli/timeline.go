@@ -0,0 +1,187 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/go-errors/errors"
+	hcertcommon "github.com/minvws/nl-covid19-coronacheck-hcert/common"
+	idemixcommon "github.com/minvws/nl-covid19-coronacheck-idemix/common"
+	mobilecore "github.com/minvws/nl-covid19-coronacheck-mobile-core"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const TIMELINE_TIME_FORMAT = "2006-01-02 15:04:05 MST"
+
+// timelineInterval is a period in which the outcome of verification doesn't change, from the first second
+//  with that outcome until the first second with another outcome
+type timelineInterval struct {
+	from    int64
+	until   int64
+	outcome *compareOutcome
+}
+
+func runTimeline(timelineFlags *flag.FlagSet, configPath string, from, until int64, step time.Duration, givenVerificationPolicies, timeZone, imagePath string) error {
+	qrs, err := collectQRs(timelineFlags, imagePath)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		return errors.Errorf("Config directory '%s' does not exist\n", configPath)
+	}
+
+	if until <= from {
+		return errors.Errorf("The end of the timeline should be after its start")
+	}
+
+	if step < time.Second {
+		return errors.Errorf("The step should be at least one second")
+	}
+
+	var timelinePolicies []string
+	for _, givenPolicy := range strings.Split(givenVerificationPolicies, ",") {
+		if _, ok := policies[givenPolicy]; !ok {
+			return errors.Errorf("Unrecognized verification policy '%s'. Allowed values are: 1G, 3G", givenPolicy)
+		}
+
+		timelinePolicies = append(timelinePolicies, givenPolicy)
+	}
+
+	loc, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return errors.WrapPrefix(err, "Could not load time zone", 0)
+	}
+
+	initializeResult := mobilecore.InitializeVerifier(configPath)
+	if initializeResult.Error != "" {
+		return errors.Errorf("Could not initialize verifier: %s\n", initializeResult.Error)
+	}
+
+	return forEachQR(qrs, func(qr string) error {
+		candidates := timelineCandidates([]byte(qr))
+		for _, givenPolicy := range timelinePolicies {
+			fmt.Printf("Policy %s:\n", givenPolicy)
+
+			for _, interval := range sweepTimeline(qr, givenPolicy, from, until, int64(step/time.Second), candidates) {
+				fmt.Printf("  %s - %s  %s\n",
+					time.Unix(interval.from, 0).In(loc).Format(TIMELINE_TIME_FORMAT),
+					time.Unix(interval.until, 0).In(loc).Format(TIMELINE_TIME_FORMAT),
+					formatOutcome(interval.outcome),
+				)
+			}
+		}
+
+		return nil
+	})
+}
+
+// sweepTimeline verifies the QR at every step between from and until, and at the candidate moments of change,
+//  and searches the exact second of every change of outcome between two of those. Changes that are undone
+//  between two of those are not noticed.
+func sweepTimeline(qr string, givenPolicy string, from, until, stepSeconds int64, candidates []int64) []*timelineInterval {
+	outcomeAt := func(timestamp int64) *compareOutcome {
+		result := verifyBatchInput(&batchInput{QR: qr, Timestamp: timestamp}, givenPolicy)
+		return &compareOutcome{Status: result.Status, Reason: result.Reason}
+	}
+
+	points := map[int64]bool{until: true}
+	for point := from + stepSeconds; point < until; point += stepSeconds {
+		points[point] = true
+	}
+
+	for _, candidate := range candidates {
+		if candidate > from && candidate < until {
+			points[candidate] = true
+		}
+	}
+
+	sortedPoints := make([]int64, 0, len(points))
+	for point := range points {
+		sortedPoints = append(sortedPoints, point)
+	}
+
+	sort.Slice(sortedPoints, func(i, j int) bool {
+		return sortedPoints[i] < sortedPoints[j]
+	})
+
+	var intervals []*timelineInterval
+	intervalFrom, lo := from, from
+	loOutcome := outcomeAt(lo)
+	for _, point := range sortedPoints {
+		// There can be multiple changes between two points, which are found one after the other
+		for lo < point {
+			pointOutcome := outcomeAt(point)
+			if *pointOutcome == *loOutcome {
+				lo = point
+				break
+			}
+
+			// Find the first second with another outcome, which is after lo and at most the point
+			hi, hiOutcome := point, pointOutcome
+			for hi-lo > 1 {
+				mid := lo + (hi-lo)/2
+				midOutcome := outcomeAt(mid)
+				if *midOutcome == *loOutcome {
+					lo = mid
+				} else {
+					hi, hiOutcome = mid, midOutcome
+				}
+			}
+
+			intervals = append(intervals, &timelineInterval{from: intervalFrom, until: hi, outcome: loOutcome})
+			intervalFrom, lo, loOutcome = hi, hi, hiOutcome
+		}
+	}
+
+	return append(intervals, &timelineInterval{from: intervalFrom, until: until, outcome: loOutcome})
+}
+
+// timelineCandidates returns the moments at which the outcome is known to change or be different, so changes
+//  within a short period like the freshness of a domestic proof around its disclosure aren't missed
+func timelineCandidates(qr []byte) []int64 {
+	domesticVerifier, _ := mobilecore.GetVerifiersForCLI()
+	if idemixcommon.HasNLPrefix(qr) {
+		verifiedCred, err := domesticVerifier.VerifyQREncoded(qr)
+		if err != nil {
+			return nil
+		}
+
+		candidates := []int64{verifiedCred.DisclosureTimeSeconds}
+		validFrom, err := strconv.ParseInt(verifiedCred.Attributes["validFrom"], 10, 64)
+		if err != nil {
+			return candidates
+		}
+
+		candidates = append(candidates, validFrom)
+		validForHours, err := strconv.ParseInt(verifiedCred.Attributes["validForHours"], 10, 64)
+		if err != nil {
+			return candidates
+		}
+
+		return append(candidates, validFrom+validForHours*60*60)
+	}
+
+	cwt, err := hcertcommon.UnmarshalQREncoded(qr)
+	if err != nil {
+		return nil
+	}
+
+	hcert, err := hcertcommon.ReadCWT(cwt)
+	if err != nil {
+		return nil
+	}
+
+	return []int64{hcert.IssuedAt, hcert.ExpirationTime}
+}
+
+func formatOutcome(outcome *compareOutcome) string {
+	if outcome.Reason == "" || outcome.Reason == outcome.Status {
+		return outcome.Status
+	}
+
+	return fmt.Sprintf("%s: %s", outcome.Status, outcome.Reason)
+}
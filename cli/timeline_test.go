@@ -0,0 +1,70 @@
+package main
+
+import (
+	mobilecore "github.com/minvws/nl-covid19-coronacheck-mobile-core"
+	"github.com/minvws/nl-covid19-coronacheck-mobile-core/fixtures"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSweepTimeline(t *testing.T) {
+	initializeResult := mobilecore.InitializeVerifier("../testdata")
+	if initializeResult.Error != "" {
+		t.Fatal("Could not initialize verifier:", initializeResult.Error)
+	}
+
+	// The credential is valid for an hour from ten minutes before disclosure, and the testdata config
+	//  accepts a proof within 60 seconds of its disclosure
+	disclosedAt := time.Now().Truncate(time.Second)
+	validFrom := disclosedAt.Unix() - 600
+	validUntil := validFrom + 3600
+
+	attributes := fixtures.DefaultDomesticAttributes(disclosedAt)
+	attributes["validFrom"] = strconv.FormatInt(validFrom, 10)
+	attributes["validForHours"] = "1"
+
+	qr, err := fixtures.IssueDomestic(&fixtures.DomesticSpecification{
+		KeyIdentifier:    fixtures.TEST_KEY_IDENTIFIER,
+		PkPath:           "../testdata/pk.xml",
+		SkPath:           "../testdata/sk.xml",
+		Attributes:       attributes,
+		DisclosurePolicy: mobilecore.DISCLOSURE_POLICY_3G,
+		DisclosedAt:      disclosedAt,
+	})
+	if err != nil {
+		t.Fatal("Could not issue domestic QR:", err)
+	}
+
+	// The step is much longer than the freshness window, which must still be found exactly
+	from, until := validFrom-1000, validUntil+1000
+	intervals := sweepTimeline(string(qr), "3G", from, until, 1800, timelineCandidates(qr))
+
+	expectedIntervals := []struct {
+		from   int64
+		until  int64
+		status string
+	}{
+		{from, validFrom, "error"},
+		{validFrom, disclosedAt.Unix() - 60, "error"},
+		{disclosedAt.Unix() - 60, disclosedAt.Unix() + 61, "success"},
+		{disclosedAt.Unix() + 61, validUntil, "error"},
+		{validUntil, until, "error"},
+	}
+
+	if len(intervals) != len(expectedIntervals) {
+		t.Fatal("Expected", len(expectedIntervals), "intervals but got", len(intervals))
+	}
+
+	for i, interval := range intervals {
+		expected := expectedIntervals[i]
+		if interval.from != expected.from || interval.until != expected.until || interval.outcome.Status != expected.status {
+			t.Fatal("Unexpected interval", i, interval.from-from, interval.until-from, interval.outcome.Status, interval.outcome.Reason)
+		}
+	}
+
+	// Both periods outside of the freshness window have the same outcome
+	if *intervals[1].outcome != *intervals[3].outcome || *intervals[0].outcome == *intervals[1].outcome {
+		t.Fatal("Unexpected outcomes outside of the freshness window")
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/go-errors/errors"
+	mobilecore "github.com/minvws/nl-covid19-coronacheck-mobile-core"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// batchInput is a single line of JSONL input, where the timestamp is optional
+type batchInput struct {
+	Id        string `json:"id"`
+	QR        string `json:"qr"`
+	Timestamp int64  `json:"timestamp,omitempty"`
+}
+
+type batchResult struct {
+	Id        string                          `json:"id"`
+	Policy    string                          `json:"policy"`
+	Timestamp int64                           `json:"timestamp"`
+	Status    string                          `json:"status"`
+	Reason    string                          `json:"reason,omitempty"`
+	Error     string                          `json:"error,omitempty"`
+	Details   *mobilecore.VerificationDetails `json:"details,omitempty"`
+}
+
+type batchSummary struct {
+	Total    int            `json:"total"`
+	Statuses map[string]int `json:"statuses"`
+	Reasons  map[string]int `json:"reasons"`
+}
+
+// interpolatedNumberPattern matches standalone numbers like timestamps and amounts, but not numbers
+//  that are part of a word like 1G
+var interpolatedNumberPattern = regexp.MustCompile(`\b[0-9]+\b`)
+
+var statusNames = map[int]string{
+	mobilecore.VERIFICATION_SUCCESS:                    "success",
+	mobilecore.VERIFICATION_FAILED_UNRECOGNIZED_PREFIX: "unrecognizedPrefix",
+	mobilecore.VERIFICATION_FAILED_IS_NL_DCC:           "isNLDCC",
+	mobilecore.VERIFICATION_FAILED_ERROR:               "error",
+	mobilecore.VERIFICATION_FAILED_SCAN_LOCKED:         "scanLocked",
+	mobilecore.VERIFICATION_FAILED_REPLAYED:            "replayed",
+}
+
+func runVerifyBatch(configPath string, inputPath string, timestamp int64, givenVerificationPolicies string) error {
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		return errors.Errorf("Config directory '%s' does not exist\n", configPath)
+	}
+
+	// Choose the verification policies
+	var batchPolicies []string
+	for _, givenPolicy := range strings.Split(givenVerificationPolicies, ",") {
+		if _, ok := policies[givenPolicy]; !ok {
+			return errors.Errorf("Unrecognized verification policy '%s'. Allowed values are: 1G, 3G", givenPolicy)
+		}
+
+		batchPolicies = append(batchPolicies, givenPolicy)
+	}
+
+	// Open input, where an empty path or a dash reads from stdin
+	var reader io.Reader = os.Stdin
+	if inputPath != "" && inputPath != "-" {
+		inputFile, err := os.Open(inputPath)
+		if err != nil {
+			return errors.WrapPrefix(err, "Could not open input file", 0)
+		}
+
+		defer inputFile.Close()
+		reader = inputFile
+	}
+
+	// Initialization
+	initializeResult := mobilecore.InitializeVerifier(configPath)
+	if initializeResult.Error != "" {
+		return errors.Errorf("Could not initialize verifier: %s\n", initializeResult.Error)
+	}
+
+	summary := &batchSummary{
+		Statuses: map[string]int{},
+		Reasons:  map[string]int{},
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		input, err := parseBatchInput(line, lineNumber, timestamp)
+		if err != nil {
+			return err
+		}
+
+		for _, givenPolicy := range batchPolicies {
+			result := verifyBatchInput(input, givenPolicy)
+			summary.add(result)
+
+			err = encoder.Encode(result)
+			if err != nil {
+				return errors.WrapPrefix(err, "Could not write result", 0)
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return errors.WrapPrefix(err, "Could not read input", 0)
+	}
+
+	err := encoder.Encode(map[string]*batchSummary{"summary": summary})
+	if err != nil {
+		return errors.WrapPrefix(err, "Could not write summary", 0)
+	}
+
+	return nil
+}
+
+func (summary *batchSummary) add(result *batchResult) {
+	summary.Total++
+	summary.Statuses[result.Status]++
+	if result.Reason != "" {
+		summary.Reasons[result.Reason]++
+	}
+}
+
+// parseBatchInput reads either a JSON object or a plain QR code, which is identified by its line number
+func parseBatchInput(line string, lineNumber int, defaultTimestamp int64) (*batchInput, error) {
+	input := &batchInput{
+		Id:        strconv.Itoa(lineNumber),
+		QR:        line,
+		Timestamp: defaultTimestamp,
+	}
+
+	if !strings.HasPrefix(line, "{") {
+		return input, nil
+	}
+
+	input.QR = ""
+	err := json.Unmarshal([]byte(line), input)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, fmt.Sprintf("Could not JSON unmarshal line %d", lineNumber), 0)
+	}
+
+	if input.QR == "" {
+		return nil, errors.Errorf("No QR was given on line %d", lineNumber)
+	}
+
+	if input.Timestamp == 0 {
+		input.Timestamp = defaultTimestamp
+	}
+
+	return input, nil
+}
+
+func verifyBatchInput(input *batchInput, givenPolicy string) *batchResult {
+	verifyResult := mobilecore.VerifyWithTime([]byte(input.QR), policies[givenPolicy], input.Timestamp)
+
+	result := &batchResult{
+		Id:        input.Id,
+		Policy:    givenPolicy,
+		Timestamp: input.Timestamp,
+		Status:    statusNames[verifyResult.Status],
+		Error:     verifyResult.Error,
+		Details:   verifyResult.Details,
+	}
+
+	if result.Status == "" {
+		result.Status = strconv.Itoa(verifyResult.Status)
+	}
+
+	if verifyResult.Error != "" {
+		result.Reason = errorReason(verifyResult.Error)
+	} else if verifyResult.Status != mobilecore.VERIFICATION_SUCCESS {
+		result.Reason = result.Status
+	}
+
+	return result
+}
+
+// errorReason returns the error message with the numbers that are interpolated into it replaced, so that errors
+//  that only differ in a value like an expiration time are counted as the same reason
+func errorReason(errorMessage string) string {
+	return strings.TrimSpace(interpolatedNumberPattern.ReplaceAllString(errorMessage, "N"))
+}
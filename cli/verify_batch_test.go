@@ -0,0 +1,109 @@
+package main
+
+import (
+	mobilecore "github.com/minvws/nl-covid19-coronacheck-mobile-core"
+	"github.com/minvws/nl-covid19-coronacheck-mobile-core/fixtures"
+	"testing"
+	"time"
+)
+
+func TestParseBatchInput(t *testing.T) {
+	testCases := []struct {
+		line     string
+		expected batchInput
+	}{
+		{"NL2:ABC", batchInput{Id: "3", QR: "NL2:ABC", Timestamp: 100}},
+		{`{"id": "first", "qr": "HC1:ABC", "timestamp": 200}`, batchInput{Id: "first", QR: "HC1:ABC", Timestamp: 200}},
+		{`{"qr": "HC1:ABC"}`, batchInput{Id: "3", QR: "HC1:ABC", Timestamp: 100}},
+	}
+
+	for _, testCase := range testCases {
+		input, err := parseBatchInput(testCase.line, 3, 100)
+		if err != nil {
+			t.Fatal("Could not parse line", testCase.line, err)
+		}
+
+		if *input != testCase.expected {
+			t.Fatal("Unexpected input for line", testCase.line, input.Id, input.QR, input.Timestamp)
+		}
+	}
+
+	for _, line := range []string{`{"id": "first"}`, `{"qr": `} {
+		_, err := parseBatchInput(line, 3, 100)
+		if err == nil {
+			t.Fatal("Expected an error for line", line)
+		}
+	}
+}
+
+func TestErrorReason(t *testing.T) {
+	// Errors that only differ in an interpolated value should have the same reason
+	expired := errorReason("Could not verify DCC: Is not valid anymore; was valid until 1627462000")
+	otherExpired := errorReason("Could not verify DCC: Is not valid anymore; was valid until 1700000000")
+	if expired != otherExpired || expired != "Could not verify DCC: Is not valid anymore; was valid until N" {
+		t.Fatal("Unexpected reasons for expired DCCs:", expired, otherExpired)
+	}
+
+	// Errors that only end the same should have different reasons
+	if errorReason("Could not verify domestic QR: Invalid proof") == errorReason("Could not verify DCC: Invalid proof") {
+		t.Fatal("Different errors should have different reasons")
+	}
+
+	if reason := errorReason("The credential did not contain the required 1G attribute"); reason != "The credential did not contain the required 1G attribute" {
+		t.Fatal("Numbers within words should be kept:", reason)
+	}
+}
+
+func TestBatchSummary(t *testing.T) {
+	initializeResult := mobilecore.InitializeVerifier("../testdata")
+	if initializeResult.Error != "" {
+		t.Fatal("Could not initialize verifier:", initializeResult.Error)
+	}
+
+	now := time.Now()
+	qr, err := fixtures.IssueDomestic(&fixtures.DomesticSpecification{
+		KeyIdentifier:    fixtures.TEST_KEY_IDENTIFIER,
+		PkPath:           "../testdata/pk.xml",
+		SkPath:           "../testdata/sk.xml",
+		Attributes:       fixtures.DefaultDomesticAttributes(now),
+		DisclosurePolicy: mobilecore.DISCLOSURE_POLICY_3G,
+		DisclosedAt:      now,
+	})
+	if err != nil {
+		t.Fatal("Could not issue domestic QR:", err)
+	}
+
+	inputs := []*batchInput{
+		{Id: "fresh", QR: string(qr), Timestamp: now.Unix()},
+		{Id: "stale", QR: string(qr), Timestamp: now.Add(time.Hour).Unix()},
+		{Id: "staler", QR: string(qr), Timestamp: now.Add(2 * time.Hour).Unix()},
+		{Id: "unrecognized", QR: "ABC", Timestamp: now.Unix()},
+	}
+
+	summary := &batchSummary{
+		Statuses: map[string]int{},
+		Reasons:  map[string]int{},
+	}
+
+	for _, input := range inputs {
+		for _, givenPolicy := range []string{"1G", "3G"} {
+			summary.add(verifyBatchInput(input, givenPolicy))
+		}
+	}
+
+	// The 3G proof fails for 1G, and all stale proofs fail for the same reason
+	expectedStatuses := map[string]int{"success": 1, "error": 5, "unrecognizedPrefix": 2}
+	if summary.Total != 8 || len(summary.Statuses) != len(expectedStatuses) {
+		t.Fatal("Unexpected summary total or statuses", summary.Total, summary.Statuses)
+	}
+
+	for status, amount := range expectedStatuses {
+		if summary.Statuses[status] != amount {
+			t.Fatal("Unexpected amount for status", status, summary.Statuses[status])
+		}
+	}
+
+	if len(summary.Reasons) != 3 || summary.Reasons["unrecognizedPrefix"] != 2 {
+		t.Fatal("Unexpected summary reasons", summary.Reasons)
+	}
+}
@@ -0,0 +1,189 @@
+// Package dccissuer issues test DCCs that are signed with local ECDSA or RSA keys, so test suites and QA
+//  can create HC1 QR codes for any edge case without an external test environment
+package dccissuer
+
+import (
+	"fmt"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/go-errors/errors"
+	hcertcommon "github.com/minvws/nl-covid19-coronacheck-hcert/common"
+	"strings"
+	"time"
+)
+
+const (
+	DCC_VERSION = "1.3.0"
+
+	DISEASE_TARGETED_COVID_19 = "840539006"
+	VACCINE_TYPE_MRNA         = "1119349007"
+	TEST_RESULT_NOT_DETECTED  = "260415000"
+	TEST_TYPE_NAAT            = "LP6464-4"
+
+	DEFAULT_MEDICINAL_PRODUCT  = "EU/1/20/1528"
+	DEFAULT_MANUFACTURER       = "ORG-100030215"
+	DEFAULT_TESTING_CENTRE     = "Test centre"
+	DEFAULT_CERTIFICATE_ISSUER = "Test issuer"
+
+	YYYYMMDD_FORMAT = "2006-01-02"
+
+	// A recovery certificate is valid from 11 until 180 days after the first positive test
+	RECOVERY_VALID_FROM_DAYS  = 11
+	RECOVERY_VALID_UNTIL_DAYS = 180
+)
+
+// Specification contains the CWT fields of the certificate to issue
+type Specification struct {
+	Issuer         string
+	IssuedAt       int64
+	ExpirationTime int64
+
+	DCC *hcertcommon.DCC
+}
+
+// Issue signs the DCC as COSE_Sign1 with the key, and returns it as CWT that is CBOR serialized,
+//  zlib compressed, base45 encoded and prefixed with HC1
+func Issue(key *SigningKey, spec *Specification) ([]byte, error) {
+	if spec.DCC == nil {
+		return nil, errors.Errorf("No DCC was given")
+	}
+
+	protectedHeaderCbor, err := cbor.Marshal(&hcertcommon.CWTHeader{
+		Alg: key.algorithm(),
+		KID: key.KID(),
+	})
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not CBOR marshal CWT protected header", 0)
+	}
+
+	// Serialize the DCC separately, and then the rest of the payload
+	dccCbor, err := cbor.Marshal(spec.DCC)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not CBOR marshal DCC", 0)
+	}
+
+	payloadCbor, err := cbor.Marshal(&hcertcommon.CWTPayload{
+		Issuer:         spec.Issuer,
+		ExpirationTime: spec.ExpirationTime,
+		IssuedAt:       spec.IssuedAt,
+		HCert: &hcertcommon.RawHealthCertificate{
+			DCC: dccCbor,
+		},
+	})
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not CBOR marshal CWT payload", 0)
+	}
+
+	hash, err := hcertcommon.SerializeAndHashForSignature(protectedHeaderCbor, payloadCbor)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := key.sign(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	qr, err := hcertcommon.MarshalQREncoded(&hcertcommon.CWT{
+		Protected: protectedHeaderCbor,
+		Payload:   payloadCbor,
+		Signature: signature,
+	})
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not QR encode CWT", 0)
+	}
+
+	return qr, nil
+}
+
+// NewDCC returns a DCC without statements, where the standardized names are derived from the names
+func NewDCC(familyName, givenName, dateOfBirth string) *hcertcommon.DCC {
+	return &hcertcommon.DCC{
+		Version:     DCC_VERSION,
+		DateOfBirth: dateOfBirth,
+		Name: &hcertcommon.DCCName{
+			FamilyName:             familyName,
+			StandardizedFamilyName: standardizeName(familyName),
+			GivenName:              givenName,
+			StandardizedGivenName:  standardizeName(givenName),
+		},
+	}
+}
+
+// NewVaccination returns a COVID-19 vaccination statement, where an empty medicinal product
+//  defaults to the Pfizer vaccine
+func NewVaccination(country, medicinalProduct string, doseNumber, totalSeriesOfDoses int, dateOfVaccination string) *hcertcommon.DCCVaccination {
+	if medicinalProduct == "" {
+		medicinalProduct = DEFAULT_MEDICINAL_PRODUCT
+	}
+
+	return &hcertcommon.DCCVaccination{
+		DiseaseTargeted:       DISEASE_TARGETED_COVID_19,
+		Vaccine:               VACCINE_TYPE_MRNA,
+		MedicinalProduct:      medicinalProduct,
+		Manufacturer:          DEFAULT_MANUFACTURER,
+		DoseNumber:            doseNumber,
+		TotalSeriesOfDoses:    totalSeriesOfDoses,
+		DateOfVaccination:     dateOfVaccination,
+		CountryOfVaccination:  country,
+		CertificateIssuer:     DEFAULT_CERTIFICATE_ISSUER,
+		CertificateIdentifier: certificateIdentifier(country),
+	}
+}
+
+// NewTest returns a negative COVID-19 test statement, where an empty type of test defaults to NAAT.
+//  The time of collection is formatted as RFC 3339.
+func NewTest(country, typeOfTest, testNameAndManufacturer string, timeOfCollection time.Time) *hcertcommon.DCCTest {
+	if typeOfTest == "" {
+		typeOfTest = TEST_TYPE_NAAT
+	}
+
+	return &hcertcommon.DCCTest{
+		DiseaseTargeted:         DISEASE_TARGETED_COVID_19,
+		TypeOfTest:              typeOfTest,
+		TestNameAndManufacturer: testNameAndManufacturer,
+		DateTimeOfCollection:    timeOfCollection.UTC().Format(time.RFC3339),
+		TestResult:              TEST_RESULT_NOT_DETECTED,
+		TestingCentre:           DEFAULT_TESTING_CENTRE,
+		CountryOfVaccination:    country,
+		CertificateIssuer:       DEFAULT_CERTIFICATE_ISSUER,
+		CertificateIdentifier:   certificateIdentifier(country),
+	}
+}
+
+// NewRecovery returns a COVID-19 recovery statement, where the certificate validity follows
+//  from the date of the first positive test
+func NewRecovery(country, dateOfFirstPositiveTest string) (*hcertcommon.DCCRecovery, error) {
+	firstPositiveTest, err := time.Parse(YYYYMMDD_FORMAT, dateOfFirstPositiveTest)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not parse date of first positive test", 0)
+	}
+
+	return &hcertcommon.DCCRecovery{
+		DiseaseTargeted:         DISEASE_TARGETED_COVID_19,
+		DateOfFirstPositiveTest: dateOfFirstPositiveTest,
+		CountryOfTest:           country,
+		CertificateIssuer:       DEFAULT_CERTIFICATE_ISSUER,
+		CertificateValidFrom:    firstPositiveTest.AddDate(0, 0, RECOVERY_VALID_FROM_DAYS).Format(YYYYMMDD_FORMAT),
+		CertificateValidUntil:   firstPositiveTest.AddDate(0, 0, RECOVERY_VALID_UNTIL_DAYS).Format(YYYYMMDD_FORMAT),
+		CertificateIdentifier:   certificateIdentifier(country),
+	}, nil
+}
+
+// standardizeName returns the ICAO 9303 style name, which suffices for the ASCII names of test certificates
+func standardizeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'A' && r <= 'Z' {
+			return r
+		}
+
+		if r == ' ' || r == '-' {
+			return '<'
+		}
+
+		return -1
+	}, strings.ToUpper(name))
+}
+
+func certificateIdentifier(country string) string {
+	return fmt.Sprintf("URN:UVCI:01:%s:TEST%d", country, time.Now().UnixNano())
+}
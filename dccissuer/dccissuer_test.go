@@ -0,0 +1,125 @@
+package dccissuer
+
+import (
+	"encoding/json"
+	mobilecore "github.com/minvws/nl-covid19-coronacheck-mobile-core"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIssue(t *testing.T) {
+	configPath := t.TempDir()
+	copyFile(t, "../testdata/config.json", filepath.Join(configPath, "config.json"))
+	copyFile(t, "../testdata/public_keys.json", filepath.Join(configPath, "public_keys.json"))
+
+	now := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	dcc := NewDCC("Van der Test", "Pieter", "1980-05-23")
+	dcc.Vaccinations = append(dcc.Vaccinations, NewVaccination("BE", "", 2, 2, "2021-08-01"))
+
+	for _, keyType := range []string{KEY_TYPE_ECDSA, KEY_TYPE_RSA} {
+		key, err := GenerateSigningKey(keyType, "BEL", []string{"v"})
+		if err != nil {
+			t.Fatal("Could not generate signing key:", err)
+		}
+
+		err = key.AddToPublicKeysFile(filepath.Join(configPath, "public_keys.json"))
+		if err != nil {
+			t.Fatal("Could not add to public keys file:", err)
+		}
+
+		qr, err := Issue(key, &Specification{
+			Issuer:         "BE",
+			IssuedAt:       now.Unix(),
+			ExpirationTime: now.AddDate(1, 0, 0).Unix(),
+			DCC:            dcc,
+		})
+		if err != nil {
+			t.Fatal("Could not issue DCC:", err)
+		}
+
+		initializeResult := mobilecore.InitializeVerifier(configPath)
+		if initializeResult.Error != "" {
+			t.Fatal("Could not initialize verifier:", initializeResult.Error)
+		}
+
+		result := mobilecore.VerifyWithTime(qr, mobilecore.VERIFICATION_POLICY_3G, now.Unix())
+		if result.Status != mobilecore.VERIFICATION_SUCCESS {
+			t.Fatal("Issued", keyType, "DCC did not verify:", result.Error)
+		}
+
+		if result.Details.IssuerCountryCode != "BE" || result.Details.FirstNameInitial != "P" || result.Details.LastNameInitial != "V" {
+			t.Fatal("Unexpected verification details for", keyType, "DCC")
+		}
+	}
+
+	// The existing keys are kept, and both issued keys have been added
+	pksJson, err := os.ReadFile(filepath.Join(configPath, "public_keys.json"))
+	if err != nil {
+		t.Fatal("Could not read public keys file:", err)
+	}
+
+	var publicKeysConfig *mobilecore.PublicKeysConfig
+	err = json.Unmarshal(pksJson, &publicKeysConfig)
+	if err != nil {
+		t.Fatal("Could not JSON unmarshal public keys:", err)
+	}
+
+	if publicKeysConfig.DomesticPks["testPk"] == nil || len(publicKeysConfig.EuropeanPks) < 3 {
+		t.Fatal("Expected the existing and issued keys in the public keys file")
+	}
+}
+
+func TestLoadSigningKeyFile(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "key.pem")
+	for _, keyType := range []string{KEY_TYPE_ECDSA, KEY_TYPE_RSA} {
+		key, err := GenerateSigningKey(keyType, "NLD", nil)
+		if err != nil {
+			t.Fatal("Could not generate signing key:", err)
+		}
+
+		err = key.WriteFile(keyPath)
+		if err != nil {
+			t.Fatal("Could not write signing key:", err)
+		}
+
+		loadedKey, err := LoadSigningKeyFile(keyPath, "NLD", nil)
+		if err != nil {
+			t.Fatal("Could not load signing key:", err)
+		}
+
+		if loadedKey.KIDB64() != key.KIDB64() || loadedKey.algorithm() != key.algorithm() {
+			t.Fatal("Loaded", keyType, "key differs from the written key")
+		}
+	}
+}
+
+func TestNewRecovery(t *testing.T) {
+	rec, err := NewRecovery("NL", "2021-07-01")
+	if err != nil {
+		t.Fatal("Could not create recovery statement:", err)
+	}
+
+	if rec.CertificateValidFrom != "2021-07-12" || rec.CertificateValidUntil != "2021-12-28" {
+		t.Fatal("Unexpected recovery validity:", rec.CertificateValidFrom, rec.CertificateValidUntil)
+	}
+
+	_, err = NewRecovery("NL", "01-07-2021")
+	if err == nil {
+		t.Fatal("Expected an error for an invalid date of first positive test")
+	}
+}
+
+func copyFile(t *testing.T, from, to string) {
+	content, err := os.ReadFile(from)
+	if err != nil {
+		t.Fatal("Could not read file:", err)
+	}
+
+	err = os.WriteFile(to, content, 0600)
+	if err != nil {
+		t.Fatal("Could not write file:", err)
+	}
+}
@@ -0,0 +1,253 @@
+package dccissuer
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/go-errors/errors"
+	hcertcommon "github.com/minvws/nl-covid19-coronacheck-hcert/common"
+	hcertverifier "github.com/minvws/nl-covid19-coronacheck-hcert/verifier"
+	"os"
+)
+
+const (
+	KEY_TYPE_ECDSA = "ecdsa"
+	KEY_TYPE_RSA   = "rsa"
+
+	RSA_KEY_BITS = 2048
+)
+
+// SigningKey is a local ECDSA (P-256) or RSA private key, together with the subject alternative name and
+//  key usage that are written to the public keys entry. Without a document signer certificate, the KID
+//  is the first eight bytes of the SHA-256 hash of the DER encoded public key.
+type SigningKey struct {
+	SubjectAltName string
+	KeyUsage       []string
+
+	privateKey crypto.Signer
+	kid        []byte
+}
+
+// GenerateSigningKey generates a new ECDSA or RSA signing key
+func GenerateSigningKey(keyType string, san string, keyUsage []string) (*SigningKey, error) {
+	var privateKey crypto.Signer
+	var err error
+	switch keyType {
+	case KEY_TYPE_ECDSA:
+		privateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KEY_TYPE_RSA:
+		privateKey, err = rsa.GenerateKey(rand.Reader, RSA_KEY_BITS)
+	default:
+		return nil, errors.Errorf("Unrecognized key type '%s'. Allowed values are: ecdsa, rsa", keyType)
+	}
+
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not generate signing key", 0)
+	}
+
+	return newSigningKey(privateKey, san, keyUsage)
+}
+
+// LoadSigningKeyFile loads a PEM encoded PKCS #8, SEC 1 (EC) or PKCS #1 (RSA) private key
+func LoadSigningKeyFile(path string, san string, keyUsage []string) (*SigningKey, error) {
+	keyPem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not read signing key file", 0)
+	}
+
+	block, _ := pem.Decode(keyPem)
+	if block == nil {
+		return nil, errors.Errorf("Could not PEM decode signing key")
+	}
+
+	var parsedKey interface{}
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		parsedKey, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsedKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		parsedKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not parse signing key", 0)
+	}
+
+	switch privateKey := parsedKey.(type) {
+	case *ecdsa.PrivateKey:
+		if privateKey.Curve != elliptic.P256() {
+			return nil, errors.Errorf("Only ECDSA keys on the P-256 curve are supported")
+		}
+
+		return newSigningKey(privateKey, san, keyUsage)
+	case *rsa.PrivateKey:
+		return newSigningKey(privateKey, san, keyUsage)
+	default:
+		return nil, errors.Errorf("Only ECDSA and RSA signing keys are supported")
+	}
+}
+
+func newSigningKey(privateKey crypto.Signer, san string, keyUsage []string) (*SigningKey, error) {
+	subjectPk, err := x509.MarshalPKIXPublicKey(privateKey.Public())
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not marshal public key", 0)
+	}
+
+	kidHash := sha256.Sum256(subjectPk)
+
+	if keyUsage == nil {
+		keyUsage = []string{}
+	}
+
+	return &SigningKey{
+		SubjectAltName: san,
+		KeyUsage:       keyUsage,
+		privateKey:     privateKey,
+		kid:            kidHash[:8],
+	}, nil
+}
+
+func (key *SigningKey) KID() []byte {
+	return key.kid
+}
+
+func (key *SigningKey) KIDB64() string {
+	return base64.StdEncoding.EncodeToString(key.kid)
+}
+
+// WriteFile writes the private key as PEM encoded PKCS #8, so it can be loaded again for later issuance
+func (key *SigningKey) WriteFile(path string) error {
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key.privateKey)
+	if err != nil {
+		return errors.WrapPrefix(err, "Could not marshal signing key", 0)
+	}
+
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer})
+	err = os.WriteFile(path, keyPem, 0600)
+	if err != nil {
+		return errors.WrapPrefix(err, "Could not write signing key file", 0)
+	}
+
+	return nil
+}
+
+// PublicKeyEntry returns the European public key as it appears in the eu_keys of public_keys.json
+func (key *SigningKey) PublicKeyEntry() (*hcertverifier.AnnotatedEuropeanPk, error) {
+	subjectPk, err := x509.MarshalPKIXPublicKey(key.privateKey.Public())
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not marshal public key", 0)
+	}
+
+	return &hcertverifier.AnnotatedEuropeanPk{
+		SubjectPk:      subjectPk,
+		KeyUsage:       key.KeyUsage,
+		SubjectAltName: key.SubjectAltName,
+	}, nil
+}
+
+// AddToPublicKeysFile adds the public key entry to the eu_keys of a public_keys.json file, replacing
+//  an existing entry for the same public key. The file is created when it doesn't exist yet.
+func (key *SigningKey) AddToPublicKeysFile(path string) error {
+	entry, err := key.PublicKeyEntry()
+	if err != nil {
+		return err
+	}
+
+	// Keep all other fields of the file as-is
+	publicKeysConfig := map[string]json.RawMessage{}
+	pksJson, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(pksJson, &publicKeysConfig)
+		if err != nil {
+			return errors.WrapPrefix(err, "Could not JSON unmarshal public keys", 0)
+		}
+	} else if !os.IsNotExist(err) {
+		return errors.WrapPrefix(err, "Could not read public keys file", 0)
+	}
+
+	europeanPks := map[string][]*hcertverifier.AnnotatedEuropeanPk{}
+	if europeanPksJson, ok := publicKeysConfig["eu_keys"]; ok {
+		err = json.Unmarshal(europeanPksJson, &europeanPks)
+		if err != nil {
+			return errors.WrapPrefix(err, "Could not JSON unmarshal European public keys", 0)
+		}
+	}
+
+	kidB64 := key.KIDB64()
+	var entries []*hcertverifier.AnnotatedEuropeanPk
+	for _, existing := range europeanPks[kidB64] {
+		if string(existing.SubjectPk) != string(entry.SubjectPk) {
+			entries = append(entries, existing)
+		}
+	}
+
+	europeanPks[kidB64] = append(entries, entry)
+
+	publicKeysConfig["eu_keys"], err = json.Marshal(europeanPks)
+	if err != nil {
+		return errors.WrapPrefix(err, "Could not JSON marshal European public keys", 0)
+	}
+
+	// A new file gets empty domestic keys, so it can be loaded by the verifier
+	if _, ok := publicKeysConfig["nl_keys"]; !ok {
+		publicKeysConfig["nl_keys"] = json.RawMessage("{}")
+	}
+
+	pksJson, err = json.MarshalIndent(publicKeysConfig, "", "  ")
+	if err != nil {
+		return errors.WrapPrefix(err, "Could not JSON marshal public keys", 0)
+	}
+
+	err = os.WriteFile(path, append(pksJson, '\n'), 0644)
+	if err != nil {
+		return errors.WrapPrefix(err, "Could not write public keys file", 0)
+	}
+
+	return nil
+}
+
+// algorithm returns the COSE algorithm of the key, where RSA keys sign with PSS
+func (key *SigningKey) algorithm() int {
+	if _, ok := key.privateKey.(*rsa.PrivateKey); ok {
+		return hcertcommon.ALG_PS256
+	}
+
+	return hcertcommon.ALG_ES256
+}
+
+// sign signs the hash, where an ECDSA signature is encoded as the fixed length concatenation of r and s
+func (key *SigningKey) sign(hash []byte) ([]byte, error) {
+	switch privateKey := key.privateKey.(type) {
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, privateKey, hash)
+		if err != nil {
+			return nil, errors.WrapPrefix(err, "Could not ECDSA sign", 0)
+		}
+
+		keyByteSize := privateKey.Curve.Params().BitSize / 8
+		signature := make([]byte, keyByteSize*2)
+		r.FillBytes(signature[:keyByteSize])
+		s.FillBytes(signature[keyByteSize:])
+
+		return signature, nil
+	case *rsa.PrivateKey:
+		signature, err := rsa.SignPSS(rand.Reader, privateKey, crypto.SHA256, hash, &rsa.PSSOptions{
+			SaltLength: rsa.PSSSaltLengthEqualsHash,
+		})
+		if err != nil {
+			return nil, errors.WrapPrefix(err, "Could not RSA sign", 0)
+		}
+
+		return signature, nil
+	default:
+		return nil, errors.Errorf("Unsupported signing key type")
+	}
+}
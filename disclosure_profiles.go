@@ -0,0 +1,319 @@
+package mobilecore
+
+import (
+	"encoding/asn1"
+	"github.com/go-errors/errors"
+	"github.com/minvws/base45-go/base45"
+	idemixcommon "github.com/minvws/nl-covid19-coronacheck-idemix/common"
+	idemixverifier "github.com/minvws/nl-covid19-coronacheck-idemix/verifier"
+	"github.com/privacybydesign/gabi"
+	"github.com/privacybydesign/gabi/big"
+	gobig "math/big"
+	"sort"
+	"time"
+)
+
+// Disclosure profiles can be used as disclosure policy, next to the 1G and 3G disclosure policies.
+//  The profiles reveal the category for 1G, and their 3G variants hide it like the 3G disclosure policy does.
+const (
+	DISCLOSURE_PROFILE_NO_BIRTH_DAY    = "noBirthDay"
+	DISCLOSURE_PROFILE_NO_BIRTH_DAY_3G = "noBirthDay3G"
+	DISCLOSURE_PROFILE_INITIALS        = "initials"
+	DISCLOSURE_PROFILE_INITIALS_3G     = "initials3G"
+	DISCLOSURE_PROFILE_CATEGORY_ONLY   = "categoryOnly"
+)
+
+// PROOF_VERSION_BYTE_PROFILE prefixes proofs that are disclosed with a disclosure profile, as those
+//  cannot be expressed in the V2 and V3 serializations where only the category can be hidden
+const PROOF_VERSION_BYTE_PROFILE byte = 'P'
+
+type disclosureProfile struct {
+	// revealedAttributes are disclosed next to the mandatory attributes, and only when present in the credential
+	revealedAttributes map[string]bool
+}
+
+var (
+	// mandatoryDisclosedAttributes are needed by the verifier to check validity and freshness,
+	//  so they are disclosed by every profile
+	mandatoryDisclosedAttributes = map[string]bool{
+		"isSpecimen":    true,
+		"isPaperProof":  true,
+		"validFrom":     true,
+		"validForHours": true,
+	}
+
+	// identityAttributes are required by a verification policy unless configured otherwise
+	identityAttributes = []string{"firstNameInitial", "lastNameInitial", "birthDay", "birthMonth"}
+
+	disclosureProfiles = map[string]*disclosureProfile{
+		DISCLOSURE_PROFILE_NO_BIRTH_DAY: {
+			revealedAttributes: map[string]bool{
+				"firstNameInitial": true,
+				"lastNameInitial":  true,
+				"birthMonth":       true,
+				"category":         true,
+			},
+		},
+		DISCLOSURE_PROFILE_NO_BIRTH_DAY_3G: {
+			revealedAttributes: map[string]bool{
+				"firstNameInitial": true,
+				"lastNameInitial":  true,
+				"birthMonth":       true,
+			},
+		},
+		DISCLOSURE_PROFILE_INITIALS: {
+			revealedAttributes: map[string]bool{
+				"firstNameInitial": true,
+				"lastNameInitial":  true,
+				"category":         true,
+			},
+		},
+		DISCLOSURE_PROFILE_INITIALS_3G: {
+			revealedAttributes: map[string]bool{
+				"firstNameInitial": true,
+				"lastNameInitial":  true,
+			},
+		},
+		DISCLOSURE_PROFILE_CATEGORY_ONLY: {
+			revealedAttributes: map[string]bool{
+				"category": true,
+			},
+		},
+	}
+)
+
+// profileProofSerialization mimics the V3 serialization, but explicitly lists the indices of the disclosed
+//  attributes. The responses of the hidden attributes are in the order of their index, starting with the secret key.
+type profileProofSerialization struct {
+	DisclosureTimeSeconds int64
+	C                     *gobig.Int
+	A                     *gobig.Int
+	EResponse             *gobig.Int
+	VResponse             *gobig.Int
+	DisclosedIndices      []int
+	AResponses            []*gobig.Int
+	ADisclosed            []*gobig.Int
+}
+
+func (profile *disclosureProfile) isDisclosed(attributeType string) bool {
+	return mandatoryDisclosedAttributes[attributeType] || profile.revealedAttributes[attributeType]
+}
+
+func isProfileProof(proofQREncoded []byte) bool {
+	proofVersionByte, _, err := idemixcommon.ExtractProofVersion(proofQREncoded)
+	return err == nil && proofVersionByte == PROOF_VERSION_BYTE_PROFILE
+}
+
+func discloseWithProfileQREncoded(holderSk *big.Int, cred *gabi.Credential, profile *disclosureProfile, now time.Time) ([]byte, error) {
+	attributesAmount := len(cred.Attributes)
+	if attributesAmount < 2 {
+		return nil, errors.Errorf("Invalid amount of credential attributes")
+	}
+
+	// Set the holderSk as first attribute of the credential, like the domestic holder does
+	cred.Attributes[0] = holderSk
+
+	_, issuerPkId, attributeTypes, err := idemixcommon.DecodeMetadataAttribute(cred.Attributes[1])
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not decode metadata attribute", 0)
+	}
+
+	if len(attributeTypes) != attributesAmount-2 {
+		return nil, errors.Errorf("Unexpected amount of attributes in credential")
+	}
+
+	cred.Pk, err = findDomesticHolderPk(issuerPkId)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could find issuer public key", 0)
+	}
+
+	disclosureTimeSeconds := now.Unix()
+	challenge := idemixcommon.CalculateTimeBasedChallenge(disclosureTimeSeconds)
+
+	// Always disclose the metadata attribute
+	disclosedIndices := []int{1}
+	for i, attributeType := range attributeTypes {
+		if profile.isDisclosed(attributeType) {
+			disclosedIndices = append(disclosedIndices, i+2)
+		}
+	}
+
+	dpb, err := cred.CreateDisclosureProofBuilder(disclosedIndices, false)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Failed to create disclosure proof builder", 0)
+	}
+
+	proofList := gabi.ProofBuilderList{dpb}.BuildProofList(idemixcommon.BigOne, challenge, false)
+	if len(proofList) != 1 {
+		return nil, errors.Errorf("Invalid amount of proofs")
+	}
+
+	proof := proofList[0].(*gabi.ProofD)
+
+	ps := &profileProofSerialization{
+		DisclosureTimeSeconds: disclosureTimeSeconds,
+		C:                     proof.C.Go(),
+		A:                     proof.A.Go(),
+		EResponse:             proof.EResponse.Go(),
+		VResponse:             proof.VResponse.Go(),
+		DisclosedIndices:      disclosedIndices,
+	}
+
+	for i := 0; i < attributesAmount; i++ {
+		if disclosed, ok := proof.ADisclosed[i]; ok {
+			ps.ADisclosed = append(ps.ADisclosed, disclosed.Go())
+		} else {
+			ps.AResponses = append(ps.AResponses, proof.AResponses[i].Go())
+		}
+	}
+
+	proofAsn1, err := asn1.Marshal(*ps)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not ASN1 marshal profile proof", 0)
+	}
+
+	proofBase45, err := base45.Base45Encode(proofAsn1)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not base45 encode proof", 0)
+	}
+
+	prefix := []byte{'N', 'L', PROOF_VERSION_BYTE_PROFILE, ':'}
+	return append(prefix, proofBase45...), nil
+}
+
+// verifyProfileProofQREncoded verifies a proof that has been disclosed with a disclosure profile,
+//  and returns the verified credential together with the name of the matching profile
+func verifyProfileProofQREncoded(proofQREncoded []byte, findIssuerPk idemixcommon.FindIssuerPkFunc) (*idemixverifier.VerifiedCredential, string, error) {
+	proofVersionByte, proofBase45, err := idemixcommon.ExtractProofVersion(proofQREncoded)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if proofVersionByte != PROOF_VERSION_BYTE_PROFILE {
+		return nil, "", errors.Errorf("Unsupported proof version")
+	}
+
+	proofAsn1, err := base45.Base45Decode(proofBase45)
+	if err != nil {
+		return nil, "", errors.Errorf("Could not base45 decode profile proof")
+	}
+
+	ps := &profileProofSerialization{}
+	_, err = asn1.Unmarshal(proofAsn1, ps)
+	if err != nil {
+		return nil, "", errors.Errorf("Could not unmarshal profile proof")
+	}
+
+	// The metadata attribute must be disclosed first, and the indices must be strictly increasing
+	if len(ps.DisclosedIndices) < 1 || ps.DisclosedIndices[0] != 1 || len(ps.DisclosedIndices) != len(ps.ADisclosed) {
+		return nil, "", errors.Errorf("The metadata attribute must be disclosed")
+	}
+
+	for i := 1; i < len(ps.DisclosedIndices); i++ {
+		if ps.DisclosedIndices[i] <= ps.DisclosedIndices[i-1] {
+			return nil, "", errors.Errorf("The disclosed indices must be strictly increasing")
+		}
+	}
+
+	credentialVersion, issuerPkId, attributeTypes, err := idemixcommon.DecodeMetadataAttribute(big.Convert(ps.ADisclosed[0]))
+	if err != nil {
+		return nil, "", err
+	}
+
+	attributesAmount := len(attributeTypes) + 2
+	if ps.DisclosedIndices[len(ps.DisclosedIndices)-1] >= attributesAmount || len(ps.ADisclosed)+len(ps.AResponses) != attributesAmount {
+		return nil, "", errors.Errorf("Invalid amount of disclosures")
+	}
+
+	// Match the disclosed attributes to a profile
+	disclosed := map[int]bool{}
+	disclosedAttributeTypes := map[string]bool{}
+	for _, index := range ps.DisclosedIndices[1:] {
+		disclosed[index] = true
+		disclosedAttributeTypes[attributeTypes[index-2]] = true
+	}
+
+	profileName, err := findDisclosureProfile(attributeTypes, disclosedAttributeTypes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	proof := &gabi.ProofD{
+		C:          big.Convert(ps.C),
+		A:          big.Convert(ps.A),
+		EResponse:  big.Convert(ps.EResponse),
+		VResponse:  big.Convert(ps.VResponse),
+		AResponses: map[int]*big.Int{},
+		ADisclosed: map[int]*big.Int{1: big.Convert(ps.ADisclosed[0])},
+	}
+
+	disclosedIndex, hiddenIndex := 1, 0
+	for i := 0; i < attributesAmount; i++ {
+		if i == 1 {
+			continue
+		}
+
+		if disclosed[i] {
+			proof.ADisclosed[i] = big.Convert(ps.ADisclosed[disclosedIndex])
+			disclosedIndex++
+		} else {
+			proof.AResponses[i] = big.Convert(ps.AResponses[hiddenIndex])
+			hiddenIndex++
+		}
+	}
+
+	issuerPk, err := findIssuerPk(issuerPkId)
+	if err != nil {
+		return nil, "", err
+	}
+
+	timeBasedChallenge := idemixcommon.CalculateTimeBasedChallenge(ps.DisclosureTimeSeconds)
+	valid := gabi.ProofList{proof}.Verify([]*gabi.PublicKey{issuerPk}, idemixcommon.BigOne, timeBasedChallenge, false, []string{})
+	if !valid {
+		return nil, "", errors.Errorf("Invalid proof")
+	}
+
+	attributes := make(map[string]string)
+	for index, d := range proof.ADisclosed {
+		if index == 1 {
+			continue
+		}
+
+		attributes[attributeTypes[index-2]] = string(idemixcommon.DecodeAttributeInt(d))
+	}
+
+	return &idemixverifier.VerifiedCredential{
+		Attributes:            attributes,
+		DisclosureTimeSeconds: ps.DisclosureTimeSeconds,
+		IssuerPkId:            issuerPkId,
+		CredentialVersion:     credentialVersion,
+		ProofIdentifier:       idemixcommon.CalculateProofIdentifier(proof),
+	}, profileName, nil
+}
+
+// findDisclosureProfile returns the name of the profile that discloses exactly the given attributes
+//  for a credential with the given attribute types. Profiles are tried by name, so the result is deterministic.
+func findDisclosureProfile(attributeTypes []string, disclosedAttributeTypes map[string]bool) (string, error) {
+	names := make([]string, 0, len(disclosureProfiles))
+	for name := range disclosureProfiles {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		profile := disclosureProfiles[name]
+		matches := true
+		for _, attributeType := range attributeTypes {
+			if profile.isDisclosed(attributeType) != disclosedAttributeTypes[attributeType] {
+				matches = false
+				break
+			}
+		}
+
+		if matches {
+			return name, nil
+		}
+	}
+
+	return "", errors.Errorf("The disclosed attributes do not match a disclosure profile")
+}
@@ -1,10 +1,15 @@
 package mobilecore
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/json"
 	"github.com/go-errors/errors"
+	idemixcommon "github.com/minvws/nl-covid19-coronacheck-idemix/common"
+	idemixholder "github.com/minvws/nl-covid19-coronacheck-idemix/holder"
 	"github.com/minvws/nl-covid19-coronacheck-idemix/issuer"
 	"github.com/minvws/nl-covid19-coronacheck-idemix/issuer/localsigner"
+	"github.com/minvws/nl-covid19-coronacheck-mobile-core/fixtures/configdir"
 	"github.com/privacybydesign/gabi"
 	gabipool "github.com/privacybydesign/gabi/pool"
 	"strconv"
@@ -27,6 +32,46 @@ func TestInitialization(t *testing.T) {
 	}
 }
 
+func TestInitializationReplacesConfig(t *testing.T) {
+	// Restore the testdata config for the other tests
+	defer InitializeVerifier("./testdata")
+	defer InitializeHolder("./testdata")
+
+	// A config without the denylist and corrected issuer country codes of the testdata config
+	configDirectoryPath := t.TempDir()
+	err := configdir.Write(configDirectoryPath, "./testdata", func(config map[string]interface{}) {
+		delete(config["domesticVerificationRules"].(map[string]interface{}), "proofIdentifierDenylist")
+		delete(config["europeanVerificationRules"].(map[string]interface{}), "correctedIssuerCountryCodes")
+	}, nil)
+	if err != nil {
+		t.Fatal("Could not write config:", err)
+	}
+
+	// Rules that are removed from the config should no longer apply, and rules that are added should apply
+	for i, path := range []string{"./testdata", configDirectoryPath, "./testdata"} {
+		r1 := InitializeVerifier(path)
+		if r1.Error != "" {
+			t.Fatal("Could not initialize verifier:", r1.Error)
+		}
+
+		r2 := InitializeHolder(path)
+		if r2.Error != "" {
+			t.Fatal("Could not initialize holder:", r2.Error)
+		}
+
+		expectRules := path == "./testdata"
+		denylist := verifierConfig.DomesticVerificationRules.ProofIdentifierDenylist
+		if denylist["STFNx7A24ZI1u5WDX8X9BA=="] != expectRules {
+			t.Fatal("Unexpected denylist after initialization", i)
+		}
+
+		_, hasCorrection := holderConfig.EuropeanVerificationRules.CorrectedIssuerCountryCodes["CNAM"]
+		if hasCorrection != expectRules {
+			t.Fatal("Unexpected corrected issuer country codes after initialization", i)
+		}
+	}
+}
+
 func TestFlow(t *testing.T) {
 	credentialAmount := 3
 	credentialVersion := 3
@@ -39,21 +84,8 @@ func TestFlow(t *testing.T) {
 		t.Fatal("Could not generate holdercore secret key:", r3.Error)
 	}
 
-	// Create a signer and issuer for the tests
-	keys := []*localsigner.Key{
-		{
-			KeyIdentifier: testKeyIdentifier,
-			PkPath:        "./testdata/pk.xml",
-			SkPath:        "./testdata/sk.xml",
-		},
-	}
-
-	ls, err := localsigner.New(keys, gabipool.NewRandomPool())
-	if err != nil {
-		t.Fatal("Could not create local signer:", err)
-	}
-
-	iss := issuer.New(ls)
+	// Create an issuer for the tests
+	iss := createTestIssuer(t)
 	pim, err := iss.PrepareIssue(&issuer.PrepareIssueRequestMessage{
 		KeyIdentifier:    testKeyIdentifier,
 		CredentialAmount: credentialAmount,
@@ -192,6 +224,572 @@ func TestFlow(t *testing.T) {
 	}
 }
 
+func TestFlowWithIssuanceState(t *testing.T) {
+	credentialAmount := 2
+	credentialAttributes := buildCredentialsAttributes(credentialAmount)
+	stateKey := make([]byte, ISSUANCE_STATE_KEY_SIZE)
+
+	r1 := GenerateHolderSk()
+	if r1.Error != "" {
+		t.Fatal("Could not generate holder secret key:", r1.Error)
+	}
+
+	iss := createTestIssuer(t)
+	pim, err := iss.PrepareIssue(&issuer.PrepareIssueRequestMessage{
+		KeyIdentifier:    testKeyIdentifier,
+		CredentialAmount: credentialAmount,
+	})
+	if err != nil {
+		t.Fatal("Could not prepare issue:", err)
+	}
+
+	ismJson, err := json.Marshal(pim)
+	if err != nil {
+		t.Fatal("Could not JSON marshal issue specification message:", err)
+	}
+
+	// The state key must have the right size
+	r2 := CreateCommitmentMessageWithState(r1.Value, ismJson, stateKey[1:])
+	if r2.Error == "" {
+		t.Fatal("Creating commitments with a short state key should fail")
+	}
+
+	r3 := CreateCommitmentMessageWithState(r1.Value, ismJson, stateKey)
+	if r3.Error != "" {
+		t.Fatal("Could not create commitment message with state:", r3.Error)
+	}
+
+	var r3Value *CreateCommitmentMessageWithStateResultValue
+	err = json.Unmarshal(r3.Value, &r3Value)
+	if err != nil {
+		t.Fatal("Could not unmarshal commitment message with state:", err)
+	}
+
+	ccms, err := iss.Issue(&issuer.IssueMessage{
+		PrepareIssueMessage:    pim,
+		IssueCommitmentMessage: r3Value.IssueCommitmentMessage,
+		CredentialsAttributes:  credentialAttributes,
+		CredentialVersion:      CREATE_CREDENTIAL_VERSION,
+		KeyIdentifier:          testKeyIdentifier,
+	})
+	if err != nil {
+		t.Fatal("Could not issue create credential messages:", err)
+	}
+
+	ccmsJson, err := json.Marshal(ccms)
+	if err != nil {
+		t.Fatal("Could not marshal create credential messages:", err)
+	}
+
+	// The state should not be usable with another key or issue specification message
+	otherStateKey := make([]byte, ISSUANCE_STATE_KEY_SIZE)
+	otherStateKey[0] = 1
+
+	r4 := CreateCredentialsWithState(r1.Value, ismJson, r3Value.IssuanceState, otherStateKey, ccmsJson)
+	if r4.Error == "" {
+		t.Fatal("Creating credentials with another state key should fail")
+	}
+
+	otherPim, err := iss.PrepareIssue(&issuer.PrepareIssueRequestMessage{
+		KeyIdentifier:    testKeyIdentifier,
+		CredentialAmount: credentialAmount,
+	})
+	if err != nil {
+		t.Fatal("Could not prepare issue:", err)
+	}
+
+	otherIsmJson, err := json.Marshal(otherPim)
+	if err != nil {
+		t.Fatal("Could not JSON marshal issue specification message:", err)
+	}
+
+	r5 := CreateCredentialsWithState(r1.Value, otherIsmJson, r3Value.IssuanceState, stateKey, ccmsJson)
+	if r5.Error == "" {
+		t.Fatal("Creating credentials with another issue specification message should fail")
+	}
+
+	// Resume with the correct state, and check that the credentials can be disclosed and verified
+	r6 := CreateCredentialsWithState(r1.Value, ismJson, r3Value.IssuanceState, stateKey, ccmsJson)
+	if r6.Error != "" {
+		t.Fatal("Could not create credentials with state:", r6.Error)
+	}
+
+	var r6Values []*CreateCredentialResultValue
+	err = json.Unmarshal(r6.Value, &r6Values)
+	if err != nil {
+		t.Fatal("Could not unmarshal create credential result values:", err)
+	}
+
+	if len(r6Values) != credentialAmount {
+		t.Fatal("Invalid amount of create credential result values")
+	}
+
+	for i, val := range r6Values {
+		err = areAttributesEqualWithCredentialVersion(credentialAttributes[i], val.Attributes)
+		if err != nil {
+			t.Fatal("Attributes do not match attributes from create credentials:", err)
+		}
+	}
+
+	credJson, err := json.Marshal(r6Values[0].Credential)
+	if err != nil {
+		t.Fatal("Could not marshal credential:", err)
+	}
+
+	r7 := Disclose(r1.Value, credJson, DISCLOSURE_POLICY_3G)
+	if r7.Error != "" {
+		t.Fatal("Could not disclose credential:", r7.Error)
+	}
+
+	r8 := Verify(r7.Value, VERIFICATION_POLICY_3G)
+	if r8.Status != VERIFICATION_SUCCESS {
+		t.Fatal("Could not verify credential created with state:", r8.Error)
+	}
+}
+
+// TestResumableCredentialBuilder pins the resumable builder to the gabi CredentialBuilder it mirrors,
+//  by running both with the same randomness and comparing the commitment proofs and credentials
+func TestResumableCredentialBuilder(t *testing.T) {
+	pk, err := findDomesticHolderPk(testKeyIdentifier)
+	if err != nil {
+		t.Fatal("Could not find issuer public key:", err)
+	}
+
+	iss := createTestIssuer(t)
+	pim, err := iss.PrepareIssue(&issuer.PrepareIssueRequestMessage{
+		KeyIdentifier:    testKeyIdentifier,
+		CredentialAmount: 1,
+	})
+	if err != nil {
+		t.Fatal("Could not prepare issue:", err)
+	}
+
+	holderSk := idemixholder.GenerateSk()
+	nonce2 := idemixcommon.GenerateNonce()
+
+	// Both builders read their randomness from the crypto/rand reader in the same order
+	defaultReader := rand.Reader
+	defer func() {
+		rand.Reader = defaultReader
+	}()
+
+	rand.Reader = newDeterministicReader("resumable-credential-builder")
+	gabiBuilder := gabi.NewCredentialBuilder(pk, idemixcommon.BigOne, holderSk, nonce2, nil)
+	gabiProofs := gabi.ProofBuilderList{gabiBuilder}.BuildProofList(idemixcommon.BigOne, pim.IssuerNonce, false)
+
+	rand.Reader = newDeterministicReader("resumable-credential-builder")
+	vPrime := idemixcommon.RandomBigInt(pk.Params.LvPrime)
+	resumableBuilder := newResumableCredentialBuilder(pk, holderSk, nonce2, vPrime)
+	resumableProofs := gabi.ProofBuilderList{resumableBuilder}.BuildProofList(idemixcommon.BigOne, pim.IssuerNonce, false)
+
+	rand.Reader = defaultReader
+
+	gabiProofsJson, err := json.Marshal(gabiProofs)
+	if err != nil {
+		t.Fatal("Could not marshal gabi proofs:", err)
+	}
+
+	resumableProofsJson, err := json.Marshal(resumableProofs)
+	if err != nil {
+		t.Fatal("Could not marshal resumable proofs:", err)
+	}
+
+	if string(gabiProofsJson) != string(resumableProofsJson) {
+		t.Fatal("The resumable builder created other commitment proofs than the gabi builder")
+	}
+
+	ccms, err := iss.Issue(&issuer.IssueMessage{
+		PrepareIssueMessage:    pim,
+		IssueCommitmentMessage: &gabi.IssueCommitmentMessage{Proofs: gabiProofs, Nonce2: nonce2},
+		CredentialsAttributes:  buildCredentialsAttributes(1),
+		CredentialVersion:      CREATE_CREDENTIAL_VERSION,
+		KeyIdentifier:          testKeyIdentifier,
+	})
+	if err != nil {
+		t.Fatal("Could not issue create credential messages:", err)
+	}
+
+	attributeInts, err := idemixcommon.ComputeAttributeInts(idemixcommon.AttributeTypes[CREATE_CREDENTIAL_VERSION], ccms[0].Attributes)
+	if err != nil {
+		t.Fatal("Could not compute attributes:", err)
+	}
+
+	gabiCred, err := gabiBuilder.ConstructCredential(ccms[0].IssueSignatureMessage, attributeInts)
+	if err != nil {
+		t.Fatal("Could not construct gabi credential:", err)
+	}
+
+	resumableCred, err := resumableBuilder.constructCredential(ccms[0])
+	if err != nil {
+		t.Fatal("Could not construct resumable credential:", err)
+	}
+
+	// The resumable builder leaves out the holder secret key
+	gabiCred.Attributes[0] = nil
+
+	gabiCredJson, err := json.Marshal(gabiCred)
+	if err != nil {
+		t.Fatal("Could not marshal gabi credential:", err)
+	}
+
+	resumableCredJson, err := json.Marshal(resumableCred)
+	if err != nil {
+		t.Fatal("Could not marshal resumable credential:", err)
+	}
+
+	if string(gabiCredJson) != string(resumableCredJson) {
+		t.Fatal("The resumable builder constructed another credential than the gabi builder")
+	}
+}
+
+// deterministicReader is an endless stream of SHA-256 digests over a seed and a counter
+type deterministicReader struct {
+	seed    string
+	counter uint64
+	buffer  []byte
+}
+
+func newDeterministicReader(seed string) *deterministicReader {
+	return &deterministicReader{seed: seed}
+}
+
+func (r *deterministicReader) Read(p []byte) (int, error) {
+	for len(r.buffer) < len(p) {
+		digest := sha256.Sum256([]byte(r.seed + strconv.FormatUint(r.counter, 10)))
+		r.buffer = append(r.buffer, digest[:]...)
+		r.counter++
+	}
+
+	n := copy(p, r.buffer)
+	r.buffer = r.buffer[n:]
+	return n, nil
+}
+
+func TestDiscloseBatch(t *testing.T) {
+	holderSkJson, credsJson := issueTestCredentials(t, buildCredentialsAttributes(1))
+
+	now := time.Now().Unix()
+	unixTimes := []int64{now + 120, now, now + 60, now + 180}
+	unixTimesJson, err := json.Marshal(unixTimes)
+	if err != nil {
+		t.Fatal("Could not JSON marshal unix times:", err)
+	}
+
+	r1 := DiscloseBatch(holderSkJson, credsJson[0], DISCLOSURE_POLICY_3G, unixTimesJson)
+	if r1.Error != "" {
+		t.Fatal("Could not disclose batch:", r1.Error)
+	}
+
+	var disclosures []*DiscloseBatchResultValue
+	err = json.Unmarshal(r1.Value, &disclosures)
+	if err != nil {
+		t.Fatal("Could not unmarshal disclosure batch:", err)
+	}
+
+	if len(disclosures) != len(unixTimes) {
+		t.Fatal("Unexpected amount of disclosures")
+	}
+
+	for i, disclosure := range disclosures {
+		if i > 0 && disclosures[i-1].DisclosureTimeSeconds >= disclosure.DisclosureTimeSeconds {
+			t.Fatal("Disclosures should be sorted by disclosure time")
+		}
+
+		// Every proof should verify at its own disclosure time, but not long after
+		r2 := VerifyWithTime(disclosure.QR, VERIFICATION_POLICY_3G, disclosure.DisclosureTimeSeconds)
+		if r2.Status != VERIFICATION_SUCCESS {
+			t.Fatal("Could not verify batch disclosure", i, r2.Error)
+		}
+
+		r3 := VerifyWithTime(disclosure.QR, VERIFICATION_POLICY_3G, disclosure.DisclosureTimeSeconds+600)
+		if r3.Status == VERIFICATION_SUCCESS {
+			t.Fatal("Batch disclosure", i, "should not verify long after its disclosure time")
+		}
+	}
+
+	// Invalid input
+	r4 := DiscloseBatch(holderSkJson, credsJson[0], DISCLOSURE_POLICY_3G, []byte("[]"))
+	if r4.Error == "" {
+		t.Fatal("Disclosing an empty batch should fail")
+	}
+
+	r5 := DiscloseBatch(holderSkJson, credsJson[0], "2", unixTimesJson)
+	if r5.Error == "" {
+		t.Fatal("Disclosing a batch with an unrecognized policy should fail")
+	}
+}
+
+func TestReadDomesticPaperProof(t *testing.T) {
+	credentialsAttributes := buildCredentialsAttributes(2)
+	credentialsAttributes[0]["isPaperProof"] = "1"
+	holderSkJson, credsJson := issueTestCredentials(t, credentialsAttributes)
+
+	r1 := Disclose(holderSkJson, credsJson[0], DISCLOSURE_POLICY_1G)
+	if r1.Error != "" {
+		t.Fatal("Could not disclose paper proof:", r1.Error)
+	}
+
+	r2 := ReadDomesticPaperProof(r1.Value)
+	if r2.Error != "" {
+		t.Fatal("Could not read paper proof:", r2.Error)
+	}
+
+	err := checkAttributesJson(credentialsAttributes[0], r2.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A disclosed credential that isn't a paper proof should not be accepted
+	r3 := Disclose(holderSkJson, credsJson[1], DISCLOSURE_POLICY_1G)
+	if r3.Error != "" {
+		t.Fatal("Could not disclose credential:", r3.Error)
+	}
+
+	r4 := ReadDomesticPaperProof(r3.Value)
+	if r4.Error == "" {
+		t.Fatal("Reading a non-paper proof as paper proof should fail")
+	}
+
+	// Neither should an invalid or non-domestic QR code
+	r5 := ReadDomesticPaperProof(r1.Value[:len(r1.Value)-10])
+	if r5.Error == "" {
+		t.Fatal("Reading a truncated paper proof should fail")
+	}
+
+	r6 := ReadDomesticPaperProof(defaultQR)
+	if r6.Error == "" {
+		t.Fatal("Reading a European QR code as paper proof should fail")
+	}
+}
+
+func TestDomesticHolderTimeline(t *testing.T) {
+	now := time.Now()
+	credentialsAttributes := buildCredentialsAttributes(3)
+	credentialsAttributes[2]["category"] = ""
+
+	_, credsJson := issueTestCredentials(t, credentialsAttributes)
+
+	wallet := &HolderWallet{
+		DomesticCredentialBatches: []*HolderWalletDomesticBatch{
+			{Id: "domestic", Credentials: []json.RawMessage{credsJson[0], credsJson[1], credsJson[2]}},
+		},
+	}
+
+	entries, err := buildTimeline(wallet, now)
+	if err != nil {
+		t.Fatal("Could not build domestic timeline:", err)
+	}
+
+	// The first two credentials expire for both policies, the last one isn't valid for 1G
+	expectedTransitionAmounts := map[string]int{
+		TIMELINE_TRANSITION_BECOMES_VALID:   1,
+		TIMELINE_TRANSITION_EXPIRES:         5,
+		TIMELINE_TRANSITION_BATCH_EXHAUSTED: 2,
+	}
+
+	transitionAmounts := map[string]int{}
+	for i, entry := range entries {
+		transitionAmounts[entry.Transition]++
+
+		if i > 0 && entries[i-1].UnixTimeSeconds > entry.UnixTimeSeconds {
+			t.Fatal("Timeline entries should be sorted by time")
+		}
+
+		if entry.UnixTimeSeconds <= now.Unix() {
+			t.Fatal("Timeline entries should be in the future")
+		}
+
+		if entry.CredentialIndex == 2 && entry.Policy == VERIFICATION_POLICY_1G {
+			t.Fatal("Credential without 1G category should not have 1G transitions")
+		}
+	}
+
+	for transition, amount := range expectedTransitionAmounts {
+		if transitionAmounts[transition] != amount {
+			t.Fatal("Expected", amount, "transitions of type", transition, "but got", transitionAmounts[transition])
+		}
+	}
+
+	// The batch is exhausted when the last credential that is valid for the policy expires
+	for _, entry := range entries {
+		if entry.Transition != TIMELINE_TRANSITION_BATCH_EXHAUSTED {
+			continue
+		}
+
+		lastIndex := 2
+		if entry.Policy == VERIFICATION_POLICY_1G {
+			lastIndex = 1
+		}
+
+		validFrom, _ := strconv.ParseInt(credentialsAttributes[lastIndex]["validFrom"], 10, 64)
+		if entry.UnixTimeSeconds != validFrom+40*60*60 {
+			t.Fatal("Unexpected batch exhausted time for policy", entry.Policy)
+		}
+	}
+}
+
+func TestHolderSkMismatch(t *testing.T) {
+	holderSkJson, credsJson := issueTestCredentials(t, buildCredentialsAttributes(1))
+
+	r1 := GenerateHolderSk()
+	if r1.Error != "" {
+		t.Fatal("Could not generate holder secret key:", r1.Error)
+	}
+
+	otherHolderSkJson := r1.Value
+
+	// Disclosing with another holder secret key should fail with a specific error
+	r2 := Disclose(otherHolderSkJson, credsJson[0], DISCLOSURE_POLICY_3G)
+	if r2.Error != HOLDER_SK_MISMATCH_ERROR {
+		t.Fatal("Disclosing with another holder secret key should fail with a mismatch error:", r2.Error)
+	}
+
+	matchedHolderSkCredentials = map[string]bool{}
+	r3 := Disclose(holderSkJson, credsJson[0], DISCLOSURE_POLICY_3G)
+	if r3.Error != "" {
+		t.Fatal("Could not disclose credential:", r3.Error)
+	}
+
+	// The match should be remembered for the holder secret key, but not for the other one
+	r3 = Disclose(holderSkJson, credsJson[0], DISCLOSURE_POLICY_3G)
+	if r3.Error != "" || len(matchedHolderSkCredentials) != 1 {
+		t.Fatal("Could not disclose credential again with the remembered match:", r3.Error)
+	}
+
+	r2 = Disclose(otherHolderSkJson, credsJson[0], DISCLOSURE_POLICY_3G)
+	if r2.Error != HOLDER_SK_MISMATCH_ERROR {
+		t.Fatal("Disclosing with another holder secret key should still fail after a match:", r2.Error)
+	}
+
+	// The matching holder secret key should be found amongst multiple keys
+	r4 := HolderSkFingerprint(holderSkJson)
+	if r4.Error != "" {
+		t.Fatal("Could not get holder secret key fingerprint:", r4.Error)
+	}
+
+	r5 := HolderSkFingerprint(otherHolderSkJson)
+	if r5.Error != "" || string(r5.Value) == string(r4.Value) {
+		t.Fatal("Different holder secret keys should have different fingerprints")
+	}
+
+	holderSksJson := []byte("[" + string(otherHolderSkJson) + "," + string(holderSkJson) + "]")
+	r6 := FindHolderSkForCredential(holderSksJson, credsJson[0])
+	if r6.Error != "" || string(r6.Value) != string(r4.Value) {
+		t.Fatal("Could not find the holder secret key for the credential:", r6.Error)
+	}
+
+	r7 := FindHolderSkForCredential([]byte("["+string(otherHolderSkJson)+"]"), credsJson[0])
+	if r7.Error != HOLDER_SK_MISMATCH_ERROR {
+		t.Fatal("Finding a holder secret key without the matching key should fail with a mismatch error")
+	}
+}
+
+func TestDisclosureProfiles(t *testing.T) {
+	credentialsAttributes := buildCredentialsAttributes(1)
+	holderSkJson, credsJson := issueTestCredentials(t, credentialsAttributes)
+
+	rules := verifierConfig.DomesticVerificationRules
+	defer func() {
+		rules.PolicyRequiredAttributes = nil
+	}()
+
+	expectedDetails := attributesToVerificationDetails(credentialsAttributes[0])
+	expectedDetails.BirthDay = ""
+	expectedDetails.DisclosureProfile = DISCLOSURE_PROFILE_NO_BIRTH_DAY
+
+	r1 := Disclose(holderSkJson, credsJson[0], DISCLOSURE_PROFILE_NO_BIRTH_DAY)
+	if r1.Error != "" {
+		t.Fatal("Could not disclose credential with profile:", r1.Error)
+	}
+
+	if !HasDomesticPrefix(r1.Value) {
+		t.Fatal("A profile disclosure should have a domestic prefix")
+	}
+
+	// By default, all identity attributes are required
+	r2 := Verify(r1.Value, VERIFICATION_POLICY_3G)
+	if r2.Status != VERIFICATION_FAILED_ERROR {
+		t.Fatal("A proof without birth day should not verify when all identity attributes are required")
+	}
+
+	rules.PolicyRequiredAttributes = map[string][]string{
+		VERIFICATION_POLICY_1G: {"category"},
+		VERIFICATION_POLICY_3G: {"firstNameInitial", "lastNameInitial"},
+	}
+
+	for _, policy := range []string{VERIFICATION_POLICY_1G, VERIFICATION_POLICY_3G} {
+		r3 := Verify(r1.Value, policy)
+		if r3.Status != VERIFICATION_SUCCESS {
+			t.Fatal("Could not verify profile proof:", r3.Error)
+		}
+
+		if *r3.Details != expectedDetails {
+			t.Fatal("Unexpected verification details for profile proof:", r3.Details)
+		}
+	}
+
+	// The 3G variant should hide the category, like the 3G disclosure policy does
+	r10 := Disclose(holderSkJson, credsJson[0], DISCLOSURE_PROFILE_NO_BIRTH_DAY_3G)
+	if r10.Error != "" {
+		t.Fatal("Could not disclose credential with profile:", r10.Error)
+	}
+
+	verifiedCred, profileName, err := verifyProfileProofQREncoded(r10.Value, findDomesticVerifierPk)
+	if err != nil {
+		t.Fatal("Could not verify 3G profile proof:", err)
+	}
+
+	if _, ok := verifiedCred.Attributes["category"]; ok || profileName != DISCLOSURE_PROFILE_NO_BIRTH_DAY_3G {
+		t.Fatal("A 3G profile proof should not disclose the category")
+	}
+
+	r11 := Verify(r10.Value, VERIFICATION_POLICY_3G)
+	if r11.Status != VERIFICATION_SUCCESS || r11.Details.DisclosureProfile != DISCLOSURE_PROFILE_NO_BIRTH_DAY_3G {
+		t.Fatal("Could not verify 3G profile proof:", r11.Error)
+	}
+
+	r12 := Verify(r10.Value, VERIFICATION_POLICY_1G)
+	if r12.Status != VERIFICATION_FAILED_ERROR {
+		t.Fatal("A 3G profile proof should not verify for 1G")
+	}
+
+	// Revealing only the category is enough for 1G, but not for 3G that requires the initials
+	r4 := Disclose(holderSkJson, credsJson[0], DISCLOSURE_PROFILE_CATEGORY_ONLY)
+	if r4.Error != "" {
+		t.Fatal("Could not disclose credential with profile:", r4.Error)
+	}
+
+	r5 := Verify(r4.Value, VERIFICATION_POLICY_1G)
+	if r5.Status != VERIFICATION_SUCCESS {
+		t.Fatal("Could not verify category only proof:", r5.Error)
+	}
+
+	if r5.Details.FirstNameInitial != "" || r5.Details.BirthMonth != "" || r5.Details.DisclosureProfile != DISCLOSURE_PROFILE_CATEGORY_ONLY {
+		t.Fatal("Unexpected verification details for category only proof:", r5.Details)
+	}
+
+	r6 := Verify(r4.Value, VERIFICATION_POLICY_3G)
+	if r6.Status != VERIFICATION_FAILED_ERROR {
+		t.Fatal("A category only proof should not verify when initials are required")
+	}
+
+	// A proof that was disclosed for a different moment should still not verify
+	r7 := DiscloseWithTime(holderSkJson, credsJson[0], DISCLOSURE_PROFILE_INITIALS, time.Now().Unix()-600)
+	if r7.Error != "" {
+		t.Fatal("Could not disclose credential with profile:", r7.Error)
+	}
+
+	r8 := Verify(r7.Value, VERIFICATION_POLICY_3G)
+	if r8.Status != VERIFICATION_FAILED_ERROR {
+		t.Fatal("A profile proof that isn't fresh should not verify")
+	}
+
+	r9 := Disclose(holderSkJson, credsJson[0], "unknownProfile")
+	if r9.Error == "" {
+		t.Fatal("Disclosing with an unknown profile should fail")
+	}
+}
+
 func TestUnrecognizedCred(t *testing.T) {
 	someQR := []byte(`1K9P/3FD!C.%2H5N4$**$IVY+3$`)
 
@@ -242,6 +840,197 @@ func TestVerificationPolicy(t *testing.T) {
 	}
 }
 
+type testScanLogStorage struct {
+	scanLogJson []byte
+}
+
+func (s *testScanLogStorage) LoadScanLog() ([]byte, error) {
+	return s.scanLogJson, nil
+}
+
+func (s *testScanLogStorage) StoreScanLog(scanLogJson []byte) error {
+	s.scanLogJson = scanLogJson
+	return nil
+}
+
+func TestScanLog(t *testing.T) {
+	someQR := []byte(`1K9P/3FD!C.%2H5N4$**$IVY+3$`)
+	storage := &testScanLogStorage{}
+	defer DisableScanLog()
+
+	r1 := EnableScanLog(storage)
+	if r1.Error != "" {
+		t.Fatal("Could not enable scan log:", r1.Error)
+	}
+
+	// The test config has a lock of 300 seconds, a warning window of 3600 seconds and a storage window of 3600 seconds
+	start := int64(1644320000)
+	r2 := VerifyWithTime(someQR, VERIFICATION_POLICY_3G, start)
+	if r2.Status != VERIFICATION_FAILED_UNRECOGNIZED_PREFIX || r2.ScanLockWarning {
+		t.Fatal("The first scan should not be locked or warned about")
+	}
+
+	r3 := VerifyWithTime(someQR, VERIFICATION_POLICY_1G, start+60)
+	if r3.Status != VERIFICATION_FAILED_SCAN_LOCKED || r3.Error == "" {
+		t.Fatal("Switching policy within the scan lock window should be locked")
+	}
+
+	r4 := VerifyWithTime(someQR, VERIFICATION_POLICY_1G, start+600)
+	if r4.Status != VERIFICATION_FAILED_UNRECOGNIZED_PREFIX || !r4.ScanLockWarning {
+		t.Fatal("Switching policy within the warning window should be warned about")
+	}
+
+	r5 := VerifyWithTime(someQR, VERIFICATION_POLICY_1G, start+660)
+	if r5.Status != VERIFICATION_FAILED_UNRECOGNIZED_PREFIX || r5.ScanLockWarning {
+		t.Fatal("Scanning again with the same policy should not be warned about")
+	}
+
+	// The scan log should survive enabling it again with the same storage
+	r6 := EnableScanLog(storage)
+	if r6.Error != "" {
+		t.Fatal("Could not enable scan log again:", r6.Error)
+	}
+
+	r7 := VerifyWithTime(someQR, VERIFICATION_POLICY_3G, start+700)
+	if r7.Status != VERIFICATION_FAILED_SCAN_LOCKED {
+		t.Fatal("The scan lock should be restored from storage")
+	}
+
+	// Entries are pruned after the storage window
+	r8 := getScanLog(time.Unix(start+3610, 0))
+	if r8.Error != "" {
+		t.Fatal("Could not get scan log:", r8.Error)
+	}
+
+	var entries []*ScanLogEntry
+	err := json.Unmarshal(r8.Value, &entries)
+	if err != nil {
+		t.Fatal("Could not unmarshal scan log:", err)
+	}
+
+	if len(entries) != 2 || entries[0].Policy != VERIFICATION_POLICY_1G || entries[0].UnixTimeSeconds != start+600 {
+		t.Fatal("Unexpected scan log entries after pruning")
+	}
+}
+
+func TestClockDeviation(t *testing.T) {
+	holderSkJson, credsJson := issueTestCredentials(t, buildCredentialsAttributes(1))
+	defer func() {
+		lastTrustedTime = nil
+	}()
+
+	serverTime := time.Now().Unix()
+	r1 := Disclose(holderSkJson, credsJson[0], DISCLOSURE_POLICY_3G)
+	if r1.Error != "" {
+		t.Fatal("Could not disclose credential:", r1.Error)
+	}
+
+	// Without a trusted server time, there is no estimate
+	r2 := getClockDeviation(5000, time.Unix(serverTime, 0))
+	if r2.Error == "" {
+		t.Fatal("Getting the clock deviation without trusted server time should fail")
+	}
+
+	SetTrustedServerTime(serverTime, 1000)
+
+	// The device clock runs ten minutes ahead, and five seconds passed on the monotonic clock
+	r3 := getClockDeviation(6000, time.Unix(serverTime+605, 0))
+	if r3.Error != "" {
+		t.Fatal("Could not get clock deviation:", r3.Error)
+	}
+
+	deviation := &ClockDeviationResultValue{}
+	err := json.Unmarshal(r3.Value, deviation)
+	if err != nil {
+		t.Fatal("Could not unmarshal clock deviation:", err)
+	}
+
+	if deviation.DeviationSeconds != 600 || !deviation.IsDeviating {
+		t.Fatal("Unexpected clock deviation:", deviation.DeviationSeconds)
+	}
+
+	r4 := getClockDeviation(6000, time.Unix(serverTime+10, 0))
+	err = json.Unmarshal(r4.Value, deviation)
+	if err != nil || deviation.DeviationSeconds != 5 || deviation.IsDeviating {
+		t.Fatal("A small clock deviation should be within the threshold")
+	}
+
+	// A reboot resets the monotonic clock
+	r5 := getClockDeviation(500, time.Unix(serverTime, 0))
+	if r5.Error == "" {
+		t.Fatal("Getting the clock deviation after a monotonic clock reset should fail")
+	}
+
+	// Verification with clock correction uses the trusted time, even when the device clock is off
+	SetTrustedServerTime(serverTime-600, 1000)
+	r6 := VerifyWithClockCorrection(r1.Value, VERIFICATION_POLICY_3G, 1000)
+	if r6.Status == VERIFICATION_SUCCESS {
+		t.Fatal("A proof from the future according to the trusted time should not verify")
+	}
+
+	SetTrustedServerTime(serverTime, 1000)
+	r7 := VerifyWithClockCorrection(r1.Value, VERIFICATION_POLICY_3G, 2000)
+	if r7.Status != VERIFICATION_SUCCESS {
+		t.Fatal("Could not verify with clock correction:", r7.Error)
+	}
+}
+
+func TestReplayDetection(t *testing.T) {
+	credentialsAttributes := buildCredentialsAttributes(2)
+	credentialsAttributes[1]["isPaperProof"] = "1"
+	holderSkJson, credsJson := issueTestCredentials(t, credentialsAttributes)
+	defer DisableReplayDetection()
+
+	r1 := Disclose(holderSkJson, credsJson[0], DISCLOSURE_POLICY_3G)
+	if r1.Error != "" {
+		t.Fatal("Could not disclose credential:", r1.Error)
+	}
+
+	r2 := EnableReplayDetection(60)
+	if r2.Error != "" {
+		t.Fatal("Could not enable replay detection:", r2.Error)
+	}
+
+	now := time.Now().Unix()
+	r3 := VerifyWithTime(r1.Value, VERIFICATION_POLICY_3G, now)
+	if r3.Status != VERIFICATION_SUCCESS {
+		t.Fatal("Could not verify credential:", r3.Error)
+	}
+
+	r4 := VerifyWithTime(r1.Value, VERIFICATION_POLICY_3G, now+10)
+	if r4.Status != VERIFICATION_FAILED_REPLAYED || r4.Details != nil {
+		t.Fatal("A replayed proof should get the replayed status")
+	}
+
+	// After the replay window, the proof is forgotten and only limited by its freshness
+	r5 := VerifyWithTime(r1.Value, VERIFICATION_POLICY_3G, now+61)
+	if r5.Status == VERIFICATION_FAILED_REPLAYED {
+		t.Fatal("A proof should not be considered replayed after the replay window")
+	}
+
+	// Paper proofs can be scanned repeatedly
+	r6 := Disclose(holderSkJson, credsJson[1], DISCLOSURE_POLICY_3G)
+	if r6.Error != "" {
+		t.Fatal("Could not disclose paper proof:", r6.Error)
+	}
+
+	for i := 0; i < 2; i++ {
+		r7 := VerifyWithTime(r6.Value, VERIFICATION_POLICY_3G, now)
+		if r7.Status != VERIFICATION_SUCCESS {
+			t.Fatal("A paper proof should not be subject to replay detection:", r7.Error)
+		}
+	}
+
+	// The cache is bounded in size
+	for i := 0; i < REPLAY_CACHE_MAXIMUM_SIZE+10; i++ {
+		checkReplay([]byte{byte(i), byte(i >> 8)}, int64(i), time.Unix(now, 0))
+	}
+
+	if len(replayCacheOrder) != REPLAY_CACHE_MAXIMUM_SIZE || len(replayCacheSeen) != REPLAY_CACHE_MAXIMUM_SIZE {
+		t.Fatal("The replay cache should be bounded in size")
+	}
+}
+
 func TestHasDomesticPrefix(t *testing.T) {
 	if !HasDomesticPrefix([]byte("NL2:")) ||
 		!HasDomesticPrefix([]byte("NLZ:")) ||
@@ -252,6 +1041,102 @@ func TestHasDomesticPrefix(t *testing.T) {
 	}
 }
 
+// issueTestCredentials runs the issuance with the test issuer, and returns the holder sk and credentials as JSON
+func issueTestCredentials(t *testing.T, credentialsAttributes []map[string]string) ([]byte, [][]byte) {
+	r1 := GenerateHolderSk()
+	if r1.Error != "" {
+		t.Fatal("Could not generate holder secret key:", r1.Error)
+	}
+
+	iss := createTestIssuer(t)
+	pim, err := iss.PrepareIssue(&issuer.PrepareIssueRequestMessage{
+		KeyIdentifier:    testKeyIdentifier,
+		CredentialAmount: len(credentialsAttributes),
+	})
+	if err != nil {
+		t.Fatal("Could not prepare issue:", err)
+	}
+
+	ismJson, err := json.Marshal(pim)
+	if err != nil {
+		t.Fatal("Could not JSON marshal issue specification message:", err)
+	}
+
+	r2 := CreateCommitmentMessage(r1.Value, ismJson)
+	if r2.Error != "" {
+		t.Fatal("Could not create commitment message:", r2.Error)
+	}
+
+	icm := new(gabi.IssueCommitmentMessage)
+	err = json.Unmarshal(r2.Value, icm)
+	if err != nil {
+		t.Fatal("Could not unmarshal issue commitment message:", err)
+	}
+
+	ccms, err := iss.Issue(&issuer.IssueMessage{
+		PrepareIssueMessage:    pim,
+		IssueCommitmentMessage: icm,
+		CredentialsAttributes:  credentialsAttributes,
+		CredentialVersion:      CREATE_CREDENTIAL_VERSION,
+		KeyIdentifier:          testKeyIdentifier,
+	})
+	if err != nil {
+		t.Fatal("Could not issue create credential messages:", err)
+	}
+
+	ccmsJson, err := json.Marshal(ccms)
+	if err != nil {
+		t.Fatal("Could not marshal create credential messages:", err)
+	}
+
+	r3 := CreateCredentials(ccmsJson)
+	if r3.Error != "" {
+		t.Fatal("Could not create credentials:", r3.Error)
+	}
+
+	var values []*CreateCredentialResultValue
+	err = json.Unmarshal(r3.Value, &values)
+	if err != nil {
+		t.Fatal("Could not unmarshal create credential result values:", err)
+	}
+
+	r4 := HolderSkFingerprint(r1.Value)
+	for _, value := range values {
+		if value.HolderSkFingerprint != string(r4.Value) {
+			t.Fatal("The credential should be bound to the holder secret key fingerprint")
+		}
+	}
+
+	credsJson := make([][]byte, 0, len(values))
+	for _, value := range values {
+		credJson, err := json.Marshal(value.Credential)
+		if err != nil {
+			t.Fatal("Could not marshal credential:", err)
+		}
+
+		credsJson = append(credsJson, credJson)
+	}
+
+	return r1.Value, credsJson
+}
+
+func createTestIssuer(t *testing.T) *issuer.Issuer {
+	keys := []*localsigner.Key{
+		{
+			KeyIdentifier: testKeyIdentifier,
+			PkPath:        "./testdata/pk.xml",
+			SkPath:        "./testdata/sk.xml",
+		},
+	}
+
+	ls, err := localsigner.New(keys, gabipool.NewRandomPool())
+	if err != nil {
+		t.Fatal("Could not create local signer:", err)
+	}
+
+	return issuer.New(ls)
+}
+
 func buildCredentialsAttributes(credentialAmount int) []map[string]string {
 	cas := make([]map[string]string, 0, credentialAmount)
 
@@ -277,6 +1162,8 @@ func buildCredentialsAttributes(credentialAmount int) []map[string]string {
 }
 
 func attributesToVerificationDetails(attributes map[string]string) VerificationDetails {
+	validFrom, validUntil, _ := domesticValidity(attributes["validFrom"], attributes["validForHours"])
+
 	return VerificationDetails{
 		CredentialVersion: "3",
 		IsSpecimen:        attributes["isSpecimen"],
@@ -286,6 +1173,9 @@ func attributesToVerificationDetails(attributes map[string]string) VerificationD
 		LastNameInitial:  attributes["lastNameInitial"],
 		BirthDay:         attributes["birthDay"],
 		BirthMonth:       attributes["birthMonth"],
+
+		ValidFrom:  strconv.FormatInt(validFrom.Unix(), 10),
+		ValidUntil: strconv.FormatInt(validUntil.Unix(), 10),
 	}
 }
 
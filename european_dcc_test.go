@@ -5,6 +5,7 @@ import (
 	"fmt"
 	hcertcommon "github.com/minvws/nl-covid19-coronacheck-hcert/common"
 	"github.com/minvws/nl-covid19-coronacheck-hcert/verifier"
+	"github.com/minvws/nl-covid19-coronacheck-mobile-core/fixtures/configdir"
 	"reflect"
 	"strings"
 	"testing"
@@ -46,6 +47,12 @@ func TestDCCs(t *testing.T) {
 
 	rules := verifierConfig.EuropeanVerificationRules
 
+	perTypeRules := *rules
+	perTypeRules.TestValidityHoursPerType = map[string]int{TEST_TYPE_NAAT: 48, TEST_TYPE_RAT: 24}
+
+	manufacturerRules := *rules
+	manufacturerRules.RapidTestAllowedManufacturers = []string{"1232", "1304"}
+
 	testCases := []dccTestCase{
 		// Different amount of statements
 		{"V", rules, nil, validVaccTime, true},
@@ -218,6 +225,19 @@ func TestDCCs(t *testing.T) {
 		// Invalid datetime format
 		{"T", rules, testChange("2021-07-23", "DateTimeOfCollection"), validTestTime, false},
 
+		// Validity per test type
+		{"T", &perTypeRules, nil, "2021-07-24T20:21:59Z", true},
+		{"T", &perTypeRules, nil, "2021-07-24T20:22:01Z", false},
+		{"T", &perTypeRules, testChange("LP217198-3", "TypeOfTest"), "2021-07-23T20:21:59Z", true},
+		{"T", &perTypeRules, testChange("LP217198-3", "TypeOfTest"), "2021-07-23T20:22:01Z", false},
+
+		// Rapid test devices
+		{"T", &manufacturerRules, nil, validTestTime, true},
+		{"T", &manufacturerRules, testChange("LP217198-3", "TypeOfTest"), validTestTime, false},
+		{"T", &manufacturerRules, ratChange("1232"), validTestTime, true},
+		{"T", &manufacturerRules, ratChange(" 1304 "), validTestTime, true},
+		{"T", &manufacturerRules, ratChange("1233"), validTestTime, false},
+
 		// Special case handling
 		//
 		// GR: Whitespaces in decoded mp field
@@ -269,11 +289,243 @@ func TestDCCs(t *testing.T) {
 	}
 }
 
+func TestEvaluationTimeZone(t *testing.T) {
+	utcRules := *verifierConfig.EuropeanVerificationRules
+	utcRules.EvaluationTimeZone = ""
+	err := utcRules.prepare()
+	if err != nil {
+		t.Fatal("Could not prepare rules without a time zone:", err)
+	}
+
+	amsterdamRules := utcRules
+	amsterdamRules.EvaluationTimeZone = "Europe/Amsterdam"
+	err = amsterdamRules.prepare()
+	if err != nil {
+		t.Fatal("Could not prepare rules with a time zone:", err)
+	}
+
+	// An unknown time zone should not silently fall back to UTC
+	invalidRules := utcRules
+	invalidRules.EvaluationTimeZone = "Europe/Nowhere"
+	if invalidRules.prepare() == nil {
+		t.Fatal("Preparing rules with an unknown time zone should fail")
+	}
+
+	configDirectoryPath := t.TempDir()
+	err = configdir.Write(configDirectoryPath, "./testdata", func(config map[string]interface{}) {
+		config["europeanVerificationRules"].(map[string]interface{})["evaluationTimeZone"] = "Europe/Nowhere"
+	}, nil)
+	if err != nil {
+		t.Fatal("Could not write config:", err)
+	}
+
+	if InitializeVerifier(configDirectoryPath).Error == "" {
+		t.Fatal("Initializing the verifier with an unknown time zone should fail")
+	}
+
+	if InitializeHolder(configDirectoryPath).Error == "" {
+		t.Fatal("Initializing the holder with an unknown time zone should fail")
+	}
+
+	testCases := []struct {
+		statements string
+		changes    []structChange
+		now        string
+		isValid    bool
+		isValidUTC bool
+	}{
+		// The waiting period ends at midnight in summer time
+		{"V", nil, "2021-06-21T21:59:59Z", false, false},
+		{"V", nil, "2021-06-21T22:00:00Z", true, false},
+		{"V", nil, "2021-06-22T00:00:00Z", true, true},
+
+		// The vaccination was in summer time, and ends at midnight in winter time
+		{"V", nil, "2022-03-04T23:00:00Z", true, true},
+		{"V", nil, "2022-03-04T23:00:01Z", false, true},
+		{"V", nil, "2022-03-05T00:00:01Z", false, false},
+
+		// The waiting period starts in winter time and ends in summer time
+		{"V", vaccChange("2022-03-20", "DateOfVaccination"), "2022-04-02T21:59:59Z", false, false},
+		{"V", vaccChange("2022-03-20", "DateOfVaccination"), "2022-04-02T22:00:00Z", true, false},
+		{"V", vaccChange("2022-03-20", "DateOfVaccination"), "2022-04-03T00:00:00Z", true, true},
+
+		// The validity of minors ends on their 18th birthday
+		{"V", dobChange("2008-06-15"), "2026-06-14T21:59:59Z", true, true},
+		{"V", dobChange("2008-06-15"), "2026-06-14T22:00:01Z", false, true},
+		{"V", dobChange("2008-06-15"), "2026-06-15T00:00:01Z", false, false},
+
+		// The specified recovery validity ends at midnight
+		{"R", nil, "2021-09-11T21:59:59Z", true, true},
+		{"R", nil, "2021-09-11T22:00:01Z", false, true},
+		{"R", nil, "2021-09-12T00:00:01Z", false, false},
+	}
+
+	for i, testCase := range testCases {
+		now, _ := time.Parse(time.RFC3339, testCase.now)
+		hcert := getHcert(testCase.statements, testCase.changes)
+
+		err := validateDCC(hcert.DCC, VERIFICATION_POLICY_3G, &amsterdamRules, now)
+		if isValid := err == nil; isValid != testCase.isValid {
+			t.Fatalf("Got wrong isValid %t in the evaluation time zone for test case %d", isValid, i)
+		}
+
+		err = validateDCC(hcert.DCC, VERIFICATION_POLICY_3G, &utcRules, now)
+		if isValid := err == nil; isValid != testCase.isValidUTC {
+			t.Fatalf("Got wrong isValid %t in UTC for test case %d", isValid, i)
+		}
+	}
+}
+
+func TestDCCMultipleStatements(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339, "2021-07-23T10:00:00Z")
+	baseRules := *verifierConfig.EuropeanVerificationRules
+
+	testCases := []struct {
+		statements    string
+		changes       []structChange
+		mode          string
+		policy        string
+		usedStatement string
+	}{
+		{"VT", nil, "", VERIFICATION_POLICY_3G, ""},
+		{"VT", nil, MULTIPLE_STATEMENTS_REJECT, VERIFICATION_POLICY_3G, ""},
+		{"VT", nil, "unknown", VERIFICATION_POLICY_3G, ""},
+		{"V", nil, MULTIPLE_STATEMENTS_ALL_VALID, VERIFICATION_POLICY_3G, "vaccination:0"},
+
+		// The vaccination is valid longer than the test
+		{"VT", nil, MULTIPLE_STATEMENTS_MOST_FAVORABLE, VERIFICATION_POLICY_3G, "vaccination:0"},
+		{"VT", nil, MULTIPLE_STATEMENTS_ALL_VALID, VERIFICATION_POLICY_3G, "vaccination:0"},
+
+		// With 1G, only the test is valid
+		{"VT", nil, MULTIPLE_STATEMENTS_MOST_FAVORABLE, VERIFICATION_POLICY_1G, "test:0"},
+		{"VT", nil, MULTIPLE_STATEMENTS_ALL_VALID, VERIFICATION_POLICY_1G, ""},
+
+		// Of two tests, only the second one is recent enough
+		{"TT", testChange("2021-07-01T08:00:00Z", "DateTimeOfCollection"), MULTIPLE_STATEMENTS_MOST_FAVORABLE, VERIFICATION_POLICY_3G, "test:1"},
+		{"TT", testChange("2021-07-01T08:00:00Z", "DateTimeOfCollection"), MULTIPLE_STATEMENTS_ALL_VALID, VERIFICATION_POLICY_3G, ""},
+	}
+
+	for i, testCase := range testCases {
+		rules := baseRules
+		rules.MultipleStatementsMode = testCase.mode
+
+		hcert := getHcert(testCase.statements, testCase.changes)
+		statement, _, _, err := validateDCCWithStatement(hcert.DCC, testCase.policy, &rules, now)
+
+		isValid := err == nil
+		if isValid != (testCase.usedStatement != "") {
+			t.Fatalf("Got wrong isValid %t for test case %d", isValid, i)
+		}
+
+		if isValid && statement.String() != testCase.usedStatement {
+			t.Fatalf("Got wrong used statement %s for test case %d", statement.String(), i)
+		}
+	}
+}
+
+func TestAgeBrackets(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339, "2021-07-25T10:00:00Z")
+	rules := *verifierConfig.EuropeanVerificationRules
+	rules.AgeBrackets = []*ageBracket{
+		{MaximumAgeYears: 5, IsExempt: true},
+		{MaximumAgeYears: 18, TestValidityHours: 72, AcceptedStatementTypes: []string{DCC_STATEMENT_VACCINATION, DCC_STATEMENT_TEST}},
+	}
+
+	testCases := []struct {
+		statements string
+		dob        string
+		isValid    bool
+	}{
+		// The test is only recent enough with the test validity for minors
+		{"T", "1990-01-01", false},
+		{"T", "2010-03-01", true},
+		{"T", "2003-08", true},
+		{"T", "2003-07", false},
+		{"T", "", false},
+
+		// Recoveries aren't accepted for minors, unless they are exempt
+		{"R", "1990-01-01", true},
+		{"R", "2010-03-01", false},
+		{"R", "2016", false},
+		{"R", "2017", true},
+		{"R", "2016-07-26", true},
+		{"R", "2016-07-25", false},
+	}
+
+	for i, testCase := range testCases {
+		hcert := getHcert(testCase.statements, dobChange(testCase.dob))
+		err := validateDCC(hcert.DCC, VERIFICATION_POLICY_3G, &rules, now)
+
+		isValid := err == nil
+		if isValid != testCase.isValid {
+			t.Fatalf("Got wrong isValid %t for test case %d", isValid, i)
+		}
+	}
+
+	// Exempt holders are valid indefinitely, and minors by the test validity for minors
+	hcert := getHcert("T", dobChange("2017"))
+	_, _, validUntil, err := validateDCCWithStatement(hcert.DCC, VERIFICATION_POLICY_3G, &rules, now)
+	if err != nil || !validUntil.IsZero() {
+		t.Fatal("An exempt holder should be valid indefinitely")
+	}
+
+	_, validUntilStr := formatValidity(time.Time{}, validUntil)
+	if validUntilStr != VALIDITY_INDEFINITE {
+		t.Fatal("Got wrong formatted indefinite validity", validUntilStr)
+	}
+
+	hcert = getHcert("T", dobChange("2010-03-01"))
+	_, _, validUntil, err = validateDCCWithStatement(hcert.DCC, VERIFICATION_POLICY_3G, &rules, now)
+	if err != nil || validUntil.Unix() != 1627244520 {
+		t.Fatal("Got wrong validity for a minor", validUntil.Unix())
+	}
+}
+
+func TestDoseClassification(t *testing.T) {
+	testCases := []struct {
+		janssen            bool
+		doseNumber         int
+		totalSeriesOfDoses int
+		classification     string
+	}{
+		{false, 1, 2, DOSE_CLASSIFICATION_PRIMARY_INCOMPLETE},
+		{false, 0, 0, DOSE_CLASSIFICATION_PRIMARY_COMPLETE},
+		{false, 1, 1, DOSE_CLASSIFICATION_PRIMARY_COMPLETE},
+		{false, 2, 2, DOSE_CLASSIFICATION_PRIMARY_COMPLETE},
+		{false, 2, 1, DOSE_CLASSIFICATION_BOOSTER},
+		{false, 3, 2, DOSE_CLASSIFICATION_BOOSTER},
+		{false, 3, 3, DOSE_CLASSIFICATION_BOOSTER},
+		{false, 3, 1, DOSE_CLASSIFICATION_ADDITIONAL},
+		{false, 4, 2, DOSE_CLASSIFICATION_ADDITIONAL},
+		{false, 4, 3, DOSE_CLASSIFICATION_ADDITIONAL},
+		{false, 4, 4, DOSE_CLASSIFICATION_ADDITIONAL},
+
+		{true, 1, 1, DOSE_CLASSIFICATION_PRIMARY_COMPLETE},
+		{true, 2, 1, DOSE_CLASSIFICATION_BOOSTER},
+		{true, 2, 2, DOSE_CLASSIFICATION_BOOSTER},
+		{true, 3, 2, DOSE_CLASSIFICATION_ADDITIONAL},
+		{true, 3, 3, DOSE_CLASSIFICATION_ADDITIONAL},
+	}
+
+	for i, testCase := range testCases {
+		changes := vaccDoseChange(testCase.doseNumber, testCase.totalSeriesOfDoses)
+		if testCase.janssen {
+			changes = vaccJanssenDose(testCase.doseNumber, testCase.totalSeriesOfDoses)
+		}
+
+		hcert := getHcert("V", changes)
+		classification := classifyDose(hcert.DCC.Vaccinations[0])
+		if classification != testCase.classification {
+			t.Fatal("Got wrong dose classification", classification, "for test case", i)
+		}
+	}
+}
+
 func TestHcertResult(t *testing.T) {
 	rules := &europeanVerificationRules{}
 
 	baseResult := VerificationDetails{
-		"1", "0", "NL", "A", "B", "13", "03",
+		"1", "0", "NL", "A", "B", "13", "03", "", "", "", "", "",
 	}
 
 	// Rest of the test cases
@@ -381,6 +633,13 @@ func vaccDoseChange(dn, sd int) []structChange {
 	)
 }
 
+func ratChange(manufacturer string) []structChange {
+	return append(
+		testChange("LP217198-3", "TypeOfTest"),
+		testChange(manufacturer, "TestNameAndManufacturer")...,
+	)
+}
+
 func vaccSingleJanssen() []structChange {
 	return append(
 		vaccChange("EU/1/20/1525", "MedicinalProduct"),
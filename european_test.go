@@ -1,6 +1,7 @@
 package mobilecore
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 )
@@ -35,6 +36,28 @@ func TestExampleQRs(t *testing.T) {
 			t.Fatal("Expected IsForeignDCC false (unreadable) for testcase", i)
 		}
 
+		r3b := explainForeignDCC(testcase.qr, now)
+		if r3b.Error != "" {
+			t.Fatal("Could not explain foreign DCC for testcase", i, r3b.Error)
+		}
+
+		var explanation *ForeignDCCExplanation
+		_ = json.Unmarshal(r3b.Value, &explanation)
+		if explanation.IsForeignDCC != r3 {
+			t.Fatal("Expected explained isForeignDCC to equal IsForeignDCC for testcase", i)
+		}
+
+		if testcase.expectedReadability &&
+			(testcase.expectedStatus == VERIFICATION_SUCCESS || testcase.expectedStatus == VERIFICATION_FAILED_IS_NL_DCC) {
+			if explanation.IssuerCountryCode != testcase.expectedCountryCode {
+				t.Fatal("Unexpected explained issuer country code", explanation.IssuerCountryCode, "for testcase", i)
+			}
+
+			if explanation.PolicyResults[VERIFICATION_POLICY_3G].Status != testcase.expectedStatus {
+				t.Fatal("Unexpected explained 3G policy status for testcase", i)
+			}
+		}
+
 		r4 := InitializeVerifier("./testdata")
 		if r4.Error != "" {
 			t.Fatal("Could not initialize verifier", r4.Error)
@@ -62,6 +85,160 @@ func TestExampleQRs(t *testing.T) {
 	}
 }
 
+func TestFullDetailVerification(t *testing.T) {
+	now := time.Unix(1627462000, 0)
+	rules := verifierConfig.EuropeanVerificationRules
+	defer func() {
+		rules.FullDetailVerificationEnabled = false
+	}()
+
+	// Full-detail verification must be enabled explicitly
+	r1 := verifyFullDetail(incorrectIssuerQR, VERIFICATION_POLICY_3G, now)
+	if r1.Status != VERIFICATION_FAILED_ERROR || r1.FullDetails != nil {
+		t.Fatal("Full-detail verification should fail when not enabled")
+	}
+
+	rules.FullDetailVerificationEnabled = true
+	r2 := verifyFullDetail(incorrectIssuerQR, VERIFICATION_POLICY_3G, now)
+	if r2.Status != VERIFICATION_SUCCESS {
+		t.Fatal("Could not verify with full detail:", r2.Error)
+	}
+
+	if *r2.Details != *frenchVerificationDetails {
+		t.Fatal("The minimal details should be the same in full-detail verification")
+	}
+
+	fullDetails := r2.FullDetails
+	if fullDetails == nil ||
+		fullDetails.StandardizedGivenName[0:1] != r2.Details.FirstNameInitial ||
+		fullDetails.StatementType == "" ||
+		fullDetails.DateOfBirth[8:10] != r2.Details.BirthDay {
+		t.Fatal("Unexpected full details:", fullDetails)
+	}
+
+	// The default verification stays privacy-minimal
+	r3 := verify(incorrectIssuerQR, VERIFICATION_POLICY_3G, now)
+	if r3.Status != VERIFICATION_SUCCESS || r3.FullDetails != nil {
+		t.Fatal("Default verification should not return full details")
+	}
+
+	// Domestic QR codes don't support full detail
+	r4 := verifyFullDetail([]byte("NL2:ABC"), VERIFICATION_POLICY_3G, now)
+	if r4.Status != VERIFICATION_FAILED_ERROR {
+		t.Fatal("Full-detail verification of a domestic QR code should fail")
+	}
+
+	// Full-detail verification should fail instead of panic without an initialized verifier
+	config := verifierConfig
+	verifierConfig = nil
+	r5 := verifyFullDetail(incorrectIssuerQR, VERIFICATION_POLICY_3G, now)
+	verifierConfig = config
+
+	if r5.Status != VERIFICATION_FAILED_ERROR || r5.Error == "" {
+		t.Fatal("Full-detail verification without an initialized verifier should fail")
+	}
+}
+
+func TestExplainForeignDCCReasons(t *testing.T) {
+	now := time.Unix(1627462000, 0)
+
+	testcases := []struct {
+		qr                                    []byte
+		expectedReason                        string
+		expectedIsCASIsland                   bool
+		expectedIssuerCountryCode             string
+		expectedIssuerCountryCodeWithoutRules string
+	}{
+		{defaultQR, FOREIGN_DCC_REASON_FOREIGN_ISSUER, false, "LL", ""},
+		{nlQR, FOREIGN_DCC_REASON_DOMESTIC_KEY, false, "NL", ""},
+		{cuwSubjectAltNameQR, FOREIGN_DCC_REASON_CAS_ISLAND_KEY, true, "CW", ""},
+		{missingSubjectAltNameQR, FOREIGN_DCC_REASON_DOMESTIC_KEY, false, "NL", ""},
+		{incorrectIssuerQR, FOREIGN_DCC_REASON_FOREIGN_ISSUER, false, "FR", ""},
+		{defaultQR[:50], FOREIGN_DCC_REASON_INVALID_DCC, false, "", ""},
+	}
+
+	// The issuer country should be determined with the rules of the holder config, or else of the verifier config
+	holderRules, verifierRules := holderConfig.EuropeanVerificationRules, verifierConfig.EuropeanVerificationRules
+	defer func() {
+		holderConfig.EuropeanVerificationRules = holderRules
+		verifierConfig.EuropeanVerificationRules = verifierRules
+	}()
+
+	configs := []struct {
+		holderRules   *europeanVerificationRules
+		verifierRules *europeanVerificationRules
+	}{
+		{holderRules, verifierRules},
+		{nil, verifierRules},
+		{nil, nil},
+	}
+
+	for _, config := range configs {
+		holderConfig.EuropeanVerificationRules = config.holderRules
+		verifierConfig.EuropeanVerificationRules = config.verifierRules
+
+		for i, testcase := range testcases {
+			explanation := buildForeignDCCExplanation(testcase.qr, now)
+			if explanation.Reason != testcase.expectedReason {
+				t.Fatal("Expected reason", testcase.expectedReason, "but got", explanation.Reason, "for testcase", i)
+			}
+
+			if explanation.IsCASIsland != testcase.expectedIsCASIsland {
+				t.Fatal("Unexpected CAS-island status for testcase", i)
+			}
+
+			expectedIssuerCountryCode := testcase.expectedIssuerCountryCode
+			if config.verifierRules == nil {
+				expectedIssuerCountryCode = testcase.expectedIssuerCountryCodeWithoutRules
+			}
+
+			if explanation.IssuerCountryCode != expectedIssuerCountryCode {
+				t.Fatal("Expected issuer country code", expectedIssuerCountryCode, "but got", explanation.IssuerCountryCode, "for testcase", i)
+			}
+
+			if (explanation.PolicyResults != nil) != (config.holderRules != nil && testcase.expectedReason != FOREIGN_DCC_REASON_INVALID_DCC) {
+				t.Fatal("Policy results should only be present with the European verification rules for testcase", i)
+			}
+		}
+	}
+}
+
+func TestHolderTimelineEuropean(t *testing.T) {
+	wallet := &HolderWallet{
+		EuropeanCredentials: []*HolderWalletEuropeanCredential{
+			{Id: "specimen", QR: string(defaultQR)},
+			{Id: "french", QR: string(incorrectIssuerQR)},
+		},
+	}
+
+	expectedEntries := []TimelineEntry{
+		{1627084800, "specimen", 0, VERIFICATION_POLICY_3G, TIMELINE_TRANSITION_BECOMES_VALID},
+		{1629151200, "french", 0, VERIFICATION_POLICY_3G, TIMELINE_TRANSITION_EXPIRES},
+		{1649203200, "specimen", 0, VERIFICATION_POLICY_3G, TIMELINE_TRANSITION_EXPIRES},
+	}
+
+	entries, err := buildTimeline(wallet, time.Unix(1626739200, 0))
+	if err != nil {
+		t.Fatal("Could not build European timeline:", err)
+	}
+
+	if len(entries) != len(expectedEntries) {
+		t.Fatal("Expected", len(expectedEntries), "timeline entries but got", len(entries))
+	}
+
+	for i, entry := range entries {
+		if *entry != expectedEntries[i] {
+			t.Fatal("Unexpected timeline entry", i)
+		}
+	}
+
+	// Unreadable credentials should result in an error
+	r1 := HolderTimeline([]byte(`{"europeanCredentials": [{"id": "invalid", "qr": "HC1:invalid"}]}`))
+	if r1.Error == "" {
+		t.Fatal("Timeline with an unreadable European credential should fail")
+	}
+}
+
 func TestParseBirthDay(t *testing.T) {
 	cases := [][]string{
 		{"1980-01-12", "valid", "1980", "01", "12"},
@@ -116,12 +293,19 @@ var missingSubjectAltNameQR = []byte(`HC1:NCF120F90T9WTWGVLK589F7I%KDP:M$-FX*4FB
 var denylistedQR = []byte(`HC1:NCF%RN%TS3DH0RGPJB/IB-OM7533SR99H9M9*VIHWFA K:SCWH3HXK6UO2Y9SA3/-2E%5G%5TW5A 6+O6XL69/9-3AKI67ZMLEQZ76QW6.V99Q9E$BDZIC9J-XIJZIC0J$PIR$SBZI92K-+T38K:ZJ83BV.T8DUFAB4DNAHLW 70SO:GOLIROGOAQ53+LDYPWGO+9A4EOHCR:36UA73NPZ.4IWM%J81:6G16IFNPCL694F$9DK4LC6DQ4394HW6.Y5K45$84-/5$B4D64OBL395$W15ORL355*K7 O%PQX76LZ6B69X5QG5AFY1OSM3-E5ZM3765WU2IMMQUKPHP-E4/H8$1YCV$QECTUKK60VEQA6E+6UCE.UUMYJ3EVFDU9VU1$D.K9H5CKMQ53K$SC4EHXDE5SBCU7RVKG9LJJDX1V4-T2DD5*J/ZCAUHZDR6UT%1WJBN0-8URPSSNIJE7UH5%5000U50/EW%E2U0`)
 var incorrectIssuerQR = []byte(`HC1:6BFOXN%TSMAHN-HJTK6.Q837FEMYV6:D4QA3Y66797$E7AOM6W430S5DO6+I-ML9LOQHIZC4.OI1RM8ZA*LPJX29+KCFF-+K*LPH*AA:GA.D8:AW/IT.7E1ME+8*2LH5OF820OPXC9IB8.A5:S9395*CBVZ0K1HO%0ORN./GZJJV8C SITK292W7*RBT1ON1EYHEQMIE9WT0K3M9UVZSVV*001HW%8UE9.955B9-NT0 2$$0X4PCY0+-CVYCDEBD0HX2JR$4O1K8KES/F-1JJ.KYII$GGX2M$C9.-B97U: KV%N %OU O4+G$UA6QKU IV*OI%KY*N9%LG O60SB+P9PK5-Q8%M-LI:7PV8PDJ3H3B 34Z.2WBPM.SY$NKUDN1B%18Y10UBR$641-ST*QGTAAY7.Y7U01 /287MRHMU/2/0GESOXESEP6K5IWYHHVN9GB%RMPRJZ/2+S4Y1QZJ498P6RV5XJ67EE/R1.DAVKBT53 F9IK6+4WM7N1BKRFO4CT2G910VI9E1`)
 
-var defaultDetails = &VerificationDetails{"1", "1", "XX", "A", "D", "15", "01"}
-var frenchVerificationDetails = &VerificationDetails{"1", "0", "FR", "J", "A", "04", "08"}
+var defaultDetails = &VerificationDetails{"1", "1", "XX", "A", "D", "15", "01", "", "", DOSE_CLASSIFICATION_PRIMARY_COMPLETE, "1627084800", "1649203200"}
+var frenchVerificationDetails = &VerificationDetails{"1", "0", "FR", "J", "A", "04", "08", "", "", DOSE_CLASSIFICATION_PRIMARY_COMPLETE, "1623880800", "1629151200"}
 
 var wholeNumberFloatDoseQR = []byte(`HC1:NCF%RN%TS3DH0RGPJB/IB-OM7533SR769CIN3XHW2KWP5IJBOJAFYHPI1SA3/-2E%5G%5TW5A 6+O6XL69/9-3AKI6/Q6LEQZ76UW6S$99Q9E$BDZIJ7JGOIRHSK2C%0KJZIC0JYPI2SSK S.-3O4UBZI92K3TSH7JPOJZ0KRPI/JTPCTHABVCNAHLW 70SO:GOLIROGO3T59YLLYP-HQLTQV*OOGOBR7Z6NC8P$WA3AA9EPBDSM+QFE4:/6N9R%EPXCROGO3HOWGOKEQ395WDUK:V9Z0O598+94DM.J9WVHWVH+ZE5%PUU1NTIUZUG-VVLIWQHSUAOP6OH6XO9IE5IVU5P2-GA*PE+E6MPO+SEMF2/GA H2.GA JG TUAJ9WLIFO5HI8J.V/I8*Z7ON1Z:LBYFEKG*ZNLT7P 7:%BU*R/L0..P5:PGSG7 9RWIXJ40H1-BW42R$D8*ZSDTOVETQTB+:RHALY3WKAJVINC/RS$B.FC+.TAWPHWC5:1/77I*5+7N UMJRF/ORN 9AKF:ONZQNT4L72V6H6$%9224U50-BWLTUB5`)
 var fractionalFloatDoseQR = []byte(`HC1:NCF%RN%TS3DH0RGPJB/IB-OM7533SR769FLT3XHW2KWP5IJBOJAFYHPI1SA3/-2E%5G%5TW5A 6+O6XL69/9-3AKI6/Q6LEQZ76UW6S$99Q9E$BDZIJ7JGOIRHSK2C%0KJZIC0JYPI2SSK S.-3O4UBZI92K3TSH7JPOJZ0KRPI/JTPCTHABVCNAHLW 70SO:GOLIROGO3T59YLY1S7HOPC5NDOEC5L64HX6IAS3DS2980IQ.DPL95OD6%28%%BPHQOGO+GOT*OBR7 Z4VBNL+1U46UF5/NVVAW+PPWC5PF6846A$QY76UW6VY9U3Q5WUZE98T5LAAY0Q$UPR$5:NLOEPNRAE69K PBKPC21%.PTM9*H9699LN9O11$DPPF5PK9CZL*H1VUUME1L8VNF6H*MF U8LELE1*.1-9VW11B%EHE14+1E*U6W1-Q6/LAPMHO99Y0VL+A*JKMJ58QKSAQQEHR8KS+D5DOGWF4EC6*MKSLFG5:SRWX1T554EWCNSQ%KD-T487*7H9DDF:KO:LKNVK/DHPUC+D1H0A:M88G000FGWSXB2 F`)
 
+func withValidity(details *VerificationDetails, validFrom, validUntil string) *VerificationDetails {
+	detailsCopy := *details
+	detailsCopy.ValidFrom, detailsCopy.ValidUntil = validFrom, validUntil
+
+	return &detailsCopy
+}
+
 var qrTestcases = []*qrTestcase{
 	{defaultQR, VERIFICATION_SUCCESS, defaultDetails, true, "LL"},
 	{defaultQR[:50], VERIFICATION_FAILED_ERROR, nil, false, ""},
@@ -132,11 +316,11 @@ var qrTestcases = []*qrTestcase{
 	{defaultQR[4:], VERIFICATION_SUCCESS, defaultDetails, false, "LL"},
 
 	// Special case of float values that should be ints (Ireland)
-	{wholeNumberFloatDoseQR, VERIFICATION_SUCCESS, defaultDetails, true, "IE"},
+	{wholeNumberFloatDoseQR, VERIFICATION_SUCCESS, withValidity(defaultDetails, "1624924800", "1647043200"), true, "IE"},
 	{fractionalFloatDoseQR, VERIFICATION_FAILED_ERROR, defaultDetails, false, ""},
 
 	// QRs signed with a kid (in testdata) that either has the CUW subject alternative name, or a missing one
-	{cuwSubjectAltNameQR, VERIFICATION_SUCCESS, defaultDetails, true, "CW"},
+	{cuwSubjectAltNameQR, VERIFICATION_SUCCESS, withValidity(defaultDetails, "1626134400", "1647043200"), true, "CW"},
 	{missingSubjectAltNameQR, VERIFICATION_FAILED_IS_NL_DCC, nil, true, "NL"},
 
 	// QR which has been denylisted in the (testdata) config
@@ -0,0 +1,58 @@
+// Package configdir writes config directories for tests, based on the config and public keys of a
+//  template directory. It doesn't depend on mobilecore, so the mobilecore tests can use it as well
+package configdir
+
+import (
+	"encoding/json"
+	"github.com/go-errors/errors"
+	"os"
+	"path"
+)
+
+const (
+	CONFIG_FILENAME      = "config.json"
+	PUBLIC_KEYS_FILENAME = "public_keys.json"
+)
+
+// Write writes the config and public keys of the template directory to the config directory. The config
+//  is modified first when a modification is given, and the public keys are replaced by the given content
+//  when it isn't nil
+func Write(configPath, templatePath string, modify func(config map[string]interface{}), pksJson []byte) error {
+	configJson, err := os.ReadFile(path.Join(templatePath, CONFIG_FILENAME))
+	if err != nil {
+		return errors.WrapPrefix(err, "Could not read config", 0)
+	}
+
+	if modify != nil {
+		var config map[string]interface{}
+		err = json.Unmarshal(configJson, &config)
+		if err != nil {
+			return errors.WrapPrefix(err, "Could not JSON unmarshal config", 0)
+		}
+
+		modify(config)
+		configJson, err = json.Marshal(config)
+		if err != nil {
+			return errors.WrapPrefix(err, "Could not JSON marshal config", 0)
+		}
+	}
+
+	if pksJson == nil {
+		pksJson, err = os.ReadFile(path.Join(templatePath, PUBLIC_KEYS_FILENAME))
+		if err != nil {
+			return errors.WrapPrefix(err, "Could not read public keys", 0)
+		}
+	}
+
+	err = os.WriteFile(path.Join(configPath, CONFIG_FILENAME), configJson, 0644)
+	if err != nil {
+		return errors.WrapPrefix(err, "Could not write config", 0)
+	}
+
+	err = os.WriteFile(path.Join(configPath, PUBLIC_KEYS_FILENAME), pksJson, 0644)
+	if err != nil {
+		return errors.WrapPrefix(err, "Could not write public keys", 0)
+	}
+
+	return nil
+}
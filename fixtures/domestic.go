@@ -0,0 +1,128 @@
+// Package fixtures creates domestic NL2 QR codes with local issuer keys, so tests and QA can generate
+//  domestic codes for any combination of attributes and disclosure time
+package fixtures
+
+import (
+	"github.com/go-errors/errors"
+	idemixholder "github.com/minvws/nl-covid19-coronacheck-idemix/holder"
+	"github.com/minvws/nl-covid19-coronacheck-idemix/issuer"
+	"github.com/minvws/nl-covid19-coronacheck-idemix/issuer/localsigner"
+	mobilecore "github.com/minvws/nl-covid19-coronacheck-mobile-core"
+	"github.com/privacybydesign/gabi"
+	gabipool "github.com/privacybydesign/gabi/pool"
+	"strconv"
+	"time"
+)
+
+const (
+	TEST_KEY_IDENTIFIER = "testPk"
+	TEST_PK_PATH        = "./testdata/pk.xml"
+	TEST_SK_PATH        = "./testdata/sk.xml"
+)
+
+// DomesticSpecification contains the attributes to issue, and the issuer key pair to issue them with.
+//  A paper proof is issued statically like a printed QR code, and other credentials are issued to
+//  a new holder secret key and disclosed at the disclosure time with the disclosure policy.
+type DomesticSpecification struct {
+	KeyIdentifier string
+	PkPath        string
+	SkPath        string
+
+	Attributes       map[string]string
+	DisclosurePolicy string
+	DisclosedAt      time.Time
+}
+
+// DefaultDomesticAttributes returns the attributes of a regular, non-specimen 1G credential that
+//  is valid from the start of the hour of now for 24 hours
+func DefaultDomesticAttributes(now time.Time) map[string]string {
+	return map[string]string{
+		"isSpecimen":       "0",
+		"isPaperProof":     "0",
+		"validFrom":        strconv.FormatInt(now.Truncate(time.Hour).Unix(), 10),
+		"validForHours":    "24",
+		"firstNameInitial": "B",
+		"lastNameInitial":  "B",
+		"birthDay":         "01",
+		"birthMonth":       "01",
+		"category":         mobilecore.CATEGORY_ATTRIBUTE_1G,
+	}
+}
+
+// IssueDomestic issues a credential with the attributes of the specification, and returns the disclosed NL2 QR code
+func IssueDomestic(spec *DomesticSpecification) ([]byte, error) {
+	ls, err := localsigner.New([]*localsigner.Key{
+		{
+			KeyIdentifier: spec.KeyIdentifier,
+			PkPath:        spec.PkPath,
+			SkPath:        spec.SkPath,
+		},
+	}, gabipool.NewRandomPool())
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not create local signer", 0)
+	}
+
+	iss := issuer.New(ls)
+	if spec.Attributes["isPaperProof"] == mobilecore.PAPER_PROOF_ATTRIBUTE_VALUE {
+		qr, _, err := iss.IssueStatic(&issuer.StaticIssueMessage{
+			CredentialAttributes: spec.Attributes,
+			CredentialVersion:    mobilecore.CREATE_CREDENTIAL_VERSION,
+			KeyIdentifier:        spec.KeyIdentifier,
+		})
+		if err != nil {
+			return nil, errors.WrapPrefix(err, "Could not issue paper proof", 0)
+		}
+
+		return qr, nil
+	}
+
+	categoryMode, err := mobilecore.DisclosureCategoryMode(spec.DisclosurePolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	// Issuance dance between the issuer and a holder that only knows the issuer public key
+	pim, err := iss.PrepareIssue(&issuer.PrepareIssueRequestMessage{
+		KeyIdentifier:    spec.KeyIdentifier,
+		CredentialAmount: 1,
+	})
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not prepare issue", 0)
+	}
+
+	pk, err := gabi.NewPublicKeyFromFile(spec.PkPath)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not load issuer public key", 0)
+	}
+
+	holder := idemixholder.New(func(_ string) (*gabi.PublicKey, error) { return pk, nil }, mobilecore.CREATE_CREDENTIAL_VERSION)
+	holderSk := idemixholder.GenerateSk()
+
+	credBuilders, icm, err := holder.CreateCommitments(holderSk, pim)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not create commitments", 0)
+	}
+
+	ccms, err := iss.Issue(&issuer.IssueMessage{
+		PrepareIssueMessage:    pim,
+		IssueCommitmentMessage: icm,
+		CredentialsAttributes:  []map[string]string{spec.Attributes},
+		CredentialVersion:      mobilecore.CREATE_CREDENTIAL_VERSION,
+		KeyIdentifier:          spec.KeyIdentifier,
+	})
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not issue credential", 0)
+	}
+
+	creds, err := holder.CreateCredentials(credBuilders, ccms)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not create credential", 0)
+	}
+
+	qr, _, err := holder.DiscloseWithTimeQREncoded(holderSk, creds[0], categoryMode, spec.DisclosedAt)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not disclose credential", 0)
+	}
+
+	return qr, nil
+}
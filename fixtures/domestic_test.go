@@ -0,0 +1,70 @@
+package fixtures
+
+import (
+	mobilecore "github.com/minvws/nl-covid19-coronacheck-mobile-core"
+	"testing"
+	"time"
+)
+
+func TestIssueDomestic(t *testing.T) {
+	initializeResult := mobilecore.InitializeVerifier("../testdata")
+	if initializeResult.Error != "" {
+		t.Fatal("Could not initialize verifier:", initializeResult.Error)
+	}
+
+	now := time.Now()
+	paperProofAttributes := DefaultDomesticAttributes(now)
+	paperProofAttributes["isPaperProof"] = mobilecore.PAPER_PROOF_ATTRIBUTE_VALUE
+
+	notYetValidAttributes := DefaultDomesticAttributes(now)
+	notYetValidAttributes["validFrom"] = "4102444800"
+
+	testCases := []struct {
+		name               string
+		attributes         map[string]string
+		disclosurePolicy   string
+		verificationPolicy string
+		expectedStatus     int
+	}{
+		{"1G disclosure", DefaultDomesticAttributes(now), mobilecore.DISCLOSURE_POLICY_1G, mobilecore.VERIFICATION_POLICY_1G, mobilecore.VERIFICATION_SUCCESS},
+		{"3G disclosure", DefaultDomesticAttributes(now), mobilecore.DISCLOSURE_POLICY_3G, mobilecore.VERIFICATION_POLICY_3G, mobilecore.VERIFICATION_SUCCESS},
+		{"3G disclosure for 1G", DefaultDomesticAttributes(now), mobilecore.DISCLOSURE_POLICY_3G, mobilecore.VERIFICATION_POLICY_1G, mobilecore.VERIFICATION_FAILED_ERROR},
+		{"paper proof", paperProofAttributes, "", mobilecore.VERIFICATION_POLICY_3G, mobilecore.VERIFICATION_SUCCESS},
+		{"not yet valid", notYetValidAttributes, mobilecore.DISCLOSURE_POLICY_3G, mobilecore.VERIFICATION_POLICY_3G, mobilecore.VERIFICATION_FAILED_ERROR},
+	}
+
+	for _, testCase := range testCases {
+		qr, err := IssueDomestic(&DomesticSpecification{
+			KeyIdentifier:    TEST_KEY_IDENTIFIER,
+			PkPath:           "../testdata/pk.xml",
+			SkPath:           "../testdata/sk.xml",
+			Attributes:       testCase.attributes,
+			DisclosurePolicy: testCase.disclosurePolicy,
+			DisclosedAt:      now,
+		})
+		if err != nil {
+			t.Fatal("Could not issue", testCase.name, "credential:", err)
+		}
+
+		result := mobilecore.VerifyWithTime(qr, testCase.verificationPolicy, now.Unix())
+		if result.Status != testCase.expectedStatus {
+			t.Fatal("Unexpected verification status for", testCase.name, "credential:", result.Status, result.Error)
+		}
+
+		if result.Status == mobilecore.VERIFICATION_SUCCESS && result.Details.FirstNameInitial != "B" {
+			t.Fatal("Unexpected verification details for", testCase.name, "credential")
+		}
+	}
+
+	_, err := IssueDomestic(&DomesticSpecification{
+		KeyIdentifier:    TEST_KEY_IDENTIFIER,
+		PkPath:           "../testdata/pk.xml",
+		SkPath:           "../testdata/sk.xml",
+		Attributes:       DefaultDomesticAttributes(now),
+		DisclosurePolicy: "2",
+		DisclosedAt:      now,
+	})
+	if err == nil {
+		t.Fatal("Expected an error for an unrecognized disclosure policy")
+	}
+}
@@ -3,7 +3,10 @@ module github.com/minvws/nl-covid19-coronacheck-mobile-core
 go 1.16
 
 require (
+	github.com/fxamacker/cbor/v2 v2.2.0
 	github.com/go-errors/errors v1.4.0
+	github.com/makiuchi-d/gozxing v0.1.1
+	github.com/minvws/base45-go v0.1.0
 	github.com/minvws/nl-covid19-coronacheck-hcert v0.5.2
 	github.com/minvws/nl-covid19-coronacheck-idemix v0.8.2
 	github.com/privacybydesign/gabi v0.1.1-coronacheck
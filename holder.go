@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	hcertholder "github.com/minvws/nl-covid19-coronacheck-hcert/holder"
 	hcertverifier "github.com/minvws/nl-covid19-coronacheck-hcert/verifier"
+	idemixcommon "github.com/minvws/nl-covid19-coronacheck-idemix/common"
 	idemixholder "github.com/minvws/nl-covid19-coronacheck-idemix/holder"
+	idemixverifier "github.com/minvws/nl-covid19-coronacheck-idemix/verifier"
 	"github.com/privacybydesign/gabi"
 	"os"
 	"path"
@@ -30,14 +32,25 @@ var (
 	domesticHolder *idemixholder.Holder
 	europeanHolder *hcertholder.Holder
 
+	// domesticPaperProofVerifier is used to read paper proofs, which are QR encoded disclosures
+	domesticPaperProofVerifier *idemixverifier.Verifier
+
+	// findDomesticHolderPk is used when constructing credentials outside of the domestic holder
+	findDomesticHolderPk idemixcommon.FindIssuerPkFunc
+
 	// euopeanPksLookup is only used to determine key SAN for CAS-islands
 	europeanPksLookup hcertverifier.PksLookup
 
-	lastCredBuilders []gabi.ProofBuilder
+	// europeanHolderVerifier is only used to explain how a DCC would be handled by the verifier
+	europeanHolderVerifier *hcertverifier.Verifier
+
+	lastCredBuilders        []gabi.ProofBuilder
+	lastHolderSkFingerprint string
 )
 
 type holderConfiguration struct {
-	// Until business rules are part of the config, we don't need anything from here
+	// The European verification rules are optional, and only used to explain how a DCC would verify
+	EuropeanVerificationRules *europeanVerificationRules `json:"europeanVerificationRules"`
 }
 
 func InitializeHolder(configDirectoryPath string) *Result {
@@ -50,21 +63,34 @@ func InitializeHolder(configDirectoryPath string) *Result {
 		return WrappedErrorResult(err, "Could not read holder config file")
 	}
 
-	err = json.Unmarshal(configJson, &holderConfig)
+	// Unmarshal into a new config, so no values of a previously loaded config remain
+	var config *holderConfiguration
+	err = json.Unmarshal(configJson, &config)
 	if err != nil {
 		return WrappedErrorResult(err, "Could not JSON unmarshal holder config")
 	}
 
+	if config != nil && config.EuropeanVerificationRules != nil {
+		err = config.EuropeanVerificationRules.prepare()
+		if err != nil {
+			return WrappedErrorResult(err, "Could not prepare European verification rules")
+		}
+	}
+
 	// Read public keys
 	publicKeysConfig, err := NewPublicKeysConfig(pksPath)
 	if err != nil {
 		return WrappedErrorResult(err, "Could not load public keys config")
 	}
 
-	// Initialize holders
+	// Only replace the config and holders when everything has loaded
+	holderConfig = config
 	domesticHolder = idemixholder.New(publicKeysConfig.FindAndCacheDomestic, CREATE_CREDENTIAL_VERSION)
 	europeanHolder = hcertholder.New()
+	domesticPaperProofVerifier = idemixverifier.New(publicKeysConfig.FindAndCacheDomestic)
+	findDomesticHolderPk = publicKeysConfig.FindAndCacheDomestic
 	europeanPksLookup = publicKeysConfig.EuropeanPks
+	europeanHolderVerifier = hcertverifier.New(publicKeysConfig.EuropeanPks)
 
 	return &Result{nil, ""}
 }
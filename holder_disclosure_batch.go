@@ -0,0 +1,122 @@
+package mobilecore
+
+import (
+	"encoding/json"
+	"github.com/go-errors/errors"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	DISCLOSE_BATCH_MAXIMUM_AMOUNT = 1000
+)
+
+type DiscloseBatchResultValue struct {
+	DisclosureTimeSeconds int64  `json:"disclosureTimeSeconds"`
+	QR                    []byte `json:"qr"`
+}
+
+// DiscloseBatch pre-computes disclosure proofs for the given JSON array of unix timestamps, so that
+//  devices with limited compute can rotate through them. Every proof is only accepted by a verifier
+//  within the configured freshness window around its disclosure time. The results are sorted by time.
+func DiscloseBatch(holderSkJson, credJson []byte, disclosurePolicy string, unixTimesSecondsJson []byte) *Result {
+	var unixTimesSeconds []int64
+	err := json.Unmarshal(unixTimesSecondsJson, &unixTimesSeconds)
+	if err != nil {
+		return WrappedErrorResult(err, "Could not unmarshal disclosure times")
+	}
+
+	if len(unixTimesSeconds) == 0 {
+		return ErrorResult(errors.Errorf("No disclosure times were provided"))
+	}
+
+	if len(unixTimesSeconds) > DISCLOSE_BATCH_MAXIMUM_AMOUNT {
+		return ErrorResult(errors.Errorf("At most %d disclosure times can be provided", DISCLOSE_BATCH_MAXIMUM_AMOUNT))
+	}
+
+	// Check the policy once upfront, instead of failing in every worker
+	err = checkDisclosurePolicy(disclosurePolicy)
+	if err != nil {
+		return ErrorResult(err)
+	}
+
+	sort.Slice(unixTimesSeconds, func(i, j int) bool {
+		return unixTimesSeconds[i] < unixTimesSeconds[j]
+	})
+
+	results, err := discloseBatch(holderSkJson, credJson, disclosurePolicy, unixTimesSeconds)
+	if err != nil {
+		return ErrorResult(err)
+	}
+
+	resultsJson, err := json.Marshal(results)
+	if err != nil {
+		return WrappedErrorResult(err, "Could not marshal disclosure batch")
+	}
+
+	return &Result{resultsJson, ""}
+}
+
+func discloseBatch(holderSkJson, credJson []byte, disclosurePolicy string, unixTimesSeconds []int64) ([]*DiscloseBatchResultValue, error) {
+	workerAmount := runtime.NumCPU()
+	if workerAmount > len(unixTimesSeconds) {
+		workerAmount = len(unixTimesSeconds)
+	}
+
+	results := make([]*DiscloseBatchResultValue, len(unixTimesSeconds))
+	errs := make([]string, len(unixTimesSeconds))
+
+	// Disclose the first one before starting the workers, so the issuer public key is loaded and cached,
+	//  and the holder sk only has to be matched to the credential once
+	res := disclose(holderSkJson, credJson, disclosurePolicy, time.Unix(unixTimesSeconds[0], 0))
+	if res.Error != "" {
+		return nil, errors.Errorf("Could not disclose credential for time %d: %s", unixTimesSeconds[0], res.Error)
+	}
+
+	results[0] = &DiscloseBatchResultValue{
+		DisclosureTimeSeconds: unixTimesSeconds[0],
+		QR:                    res.Value,
+	}
+
+	indices := make(chan int)
+	wg := sync.WaitGroup{}
+	wg.Add(workerAmount)
+
+	// Every disclosure unmarshals its own holder sk and credential,
+	//  as the domestic holder sets the holder sk and public key on the credential
+	for w := 0; w < workerAmount; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				unixTimeSeconds := unixTimesSeconds[i]
+				res := disclose(holderSkJson, credJson, disclosurePolicy, time.Unix(unixTimeSeconds, 0))
+				if res.Error != "" {
+					errs[i] = res.Error
+					continue
+				}
+
+				results[i] = &DiscloseBatchResultValue{
+					DisclosureTimeSeconds: unixTimeSeconds,
+					QR:                    res.Value,
+				}
+			}
+		}()
+	}
+
+	for i := 1; i < len(unixTimesSeconds); i++ {
+		indices <- i
+	}
+
+	close(indices)
+	wg.Wait()
+
+	for i, errStr := range errs {
+		if errStr != "" {
+			return nil, errors.Errorf("Could not disclose credential for time %d: %s", unixTimesSeconds[i], errStr)
+		}
+	}
+
+	return results, nil
+}
@@ -1,6 +1,8 @@
 package mobilecore
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
 	"github.com/go-errors/errors"
 	idemixcommon "github.com/minvws/nl-covid19-coronacheck-idemix/common"
@@ -8,12 +10,32 @@ import (
 	"github.com/privacybydesign/gabi"
 	"github.com/privacybydesign/gabi/big"
 	"strconv"
+	"sync"
 	"time"
 )
 
+const (
+	PAPER_PROOF_ATTRIBUTE_VALUE = "1"
+
+	// HOLDER_SK_MISMATCH_ERROR is returned as-is, so the app can recognize it
+	HOLDER_SK_MISMATCH_ERROR = "The holder secret key does not match the credential"
+
+	holderSkFingerprintContext = "coronacheck-holder-sk-fingerprint"
+
+	matchedHolderSkCredentialsMaximumAmount = 100
+)
+
+var (
+	// matchedHolderSkCredentials contains the credentials that were checked to match a holder sk, by a digest
+	//  of the holder sk fingerprint and the credential JSON
+	matchedHolderSkCredentials      = map[string]bool{}
+	matchedHolderSkCredentialsMutex sync.Mutex
+)
+
 type CreateCredentialResultValue struct {
-	Credential *gabi.Credential  `json:"credential"`
-	Attributes map[string]string `json:"attributes"`
+	Credential          *gabi.Credential  `json:"credential"`
+	Attributes          map[string]string `json:"attributes"`
+	HolderSkFingerprint string            `json:"holderSkFingerprint"`
 }
 
 func GenerateHolderSk() *Result {
@@ -43,6 +65,8 @@ func CreateCommitmentMessage(holderSkJson, issueSpecificationMessageJson []byte)
 		return WrappedErrorResult(err, "Could not create commitments")
 	}
 
+	lastHolderSkFingerprint = holderSkFingerprint(holderSk)
+
 	icmJson, err := json.Marshal(icm)
 	if err != nil {
 		return WrappedErrorResult(err, "Could not marshal issue commitment message")
@@ -78,8 +102,9 @@ func CreateCredentials(ccmsJson []byte) *Result {
 		}
 
 		result := &CreateCredentialResultValue{
-			Credential: cred,
-			Attributes: attributes,
+			Credential:          cred,
+			Attributes:          attributes,
+			HolderSkFingerprint: lastHolderSkFingerprint,
 		}
 
 		results = append(results, result)
@@ -112,6 +137,34 @@ func ReadDomesticCredential(credJson []byte) *Result {
 	return &Result{attributesJson, ""}
 }
 
+// ReadDomesticPaperProof verifies a printed domestic QR code with the configured domestic public keys,
+//  and returns its attributes in the same way as ReadDomesticCredential does for issued credentials
+func ReadDomesticPaperProof(proofQREncoded []byte) *Result {
+	if !idemixcommon.HasNLPrefix(proofQREncoded) {
+		return ErrorResult(errors.Errorf("The paper proof does not have a domestic prefix"))
+	}
+
+	verifiedCred, err := domesticPaperProofVerifier.VerifyQREncoded(proofQREncoded)
+	if err != nil {
+		return WrappedErrorResult(err, "Could not verify paper proof")
+	}
+
+	attributes := verifiedCred.Attributes
+	if attributes["isPaperProof"] != PAPER_PROOF_ATTRIBUTE_VALUE {
+		return ErrorResult(errors.Errorf("The domestic QR code is not a paper proof"))
+	}
+
+	// Add the credential version to the attributes
+	attributes["credentialVersion"] = strconv.Itoa(verifiedCred.CredentialVersion)
+
+	attributesJson, err := json.Marshal(attributes)
+	if err != nil {
+		return WrappedErrorResult(err, "Could marshal attributes")
+	}
+
+	return &Result{attributesJson, ""}
+}
+
 func Disclose(holderSkJson, credJson []byte, disclosurePolicy string) *Result {
 	return disclose(holderSkJson, credJson, disclosurePolicy, time.Now())
 }
@@ -120,6 +173,51 @@ func DiscloseWithTime(holderSkJson, credJson []byte, disclosurePolicy string, un
 	return disclose(holderSkJson, credJson, disclosurePolicy, time.Unix(unixTimeSeconds, 0))
 }
 
+// HolderSkFingerprint returns an identifier for the holder secret key, which can be stored together
+//  with the credentials that were issued with it
+func HolderSkFingerprint(holderSkJson []byte) *Result {
+	holderSk, err := unmarshalHolderSk(holderSkJson)
+	if err != nil {
+		return ErrorResult(err)
+	}
+
+	return &Result{[]byte(holderSkFingerprint(holderSk)), ""}
+}
+
+// FindHolderSkForCredential returns the fingerprint of the holder secret key in the given JSON array
+//  of holder secret keys that the credential has been issued to, for when multiple holder secret keys
+//  are used on a device and the credential has not been stored with a fingerprint
+func FindHolderSkForCredential(holderSksJson, credJson []byte) *Result {
+	var holderSksRaw []json.RawMessage
+	err := json.Unmarshal(holderSksJson, &holderSksRaw)
+	if err != nil {
+		return WrappedErrorResult(err, "Could not unmarshal holder secret keys")
+	}
+
+	cred, err := unmarshalCredential(credJson)
+	if err != nil {
+		return ErrorResult(err)
+	}
+
+	for _, holderSkRaw := range holderSksRaw {
+		holderSk, err := unmarshalHolderSk(holderSkRaw)
+		if err != nil {
+			return ErrorResult(err)
+		}
+
+		matches, err := holderSkMatchesCredential(holderSk, cred)
+		if err != nil {
+			return ErrorResult(err)
+		}
+
+		if matches {
+			return &Result{[]byte(holderSkFingerprint(holderSk)), ""}
+		}
+	}
+
+	return ErrorResult(errors.New(HOLDER_SK_MISMATCH_ERROR))
+}
+
 func HasDomesticPrefix(proofQREncoded []byte) bool {
 	return idemixcommon.HasNLPrefix(proofQREncoded)
 }
@@ -135,16 +233,29 @@ func disclose(holderSkJson, credJson []byte, disclosurePolicy string, now time.T
 		return ErrorResult(err)
 	}
 
-	var categoryMode int
-	if disclosurePolicy == DISCLOSURE_POLICY_1G {
-		categoryMode = holder.CATEGORY_DISCLOSED_V3_SERIALIZATION
-	} else if disclosurePolicy == DISCLOSURE_POLICY_3G {
-		categoryMode = holder.CATEGORY_HIDDEN
+	// Disclosure profiles are used next to the 1G and 3G disclosure policies
+	profile, isProfile := disclosureProfiles[disclosurePolicy]
+	categoryMode := 0
+	if !isProfile {
+		categoryMode, err = DisclosureCategoryMode(disclosurePolicy)
+		if err != nil {
+			return ErrorResult(err)
+		}
+	}
+
+	// A proof with a holder secret key that doesn't belong to the credential would never verify
+	err = checkHolderSkMatchesCredential(holderSk, cred, credJson)
+	if err != nil {
+		return ErrorResult(err)
+	}
+
+	var proofPrefixed []byte
+	if isProfile {
+		proofPrefixed, err = discloseWithProfileQREncoded(holderSk, cred, profile, now)
 	} else {
-		return ErrorResult(errors.Errorf("Unrecognized disclosure policy"))
+		proofPrefixed, _, err = domesticHolder.DiscloseWithTimeQREncoded(holderSk, cred, categoryMode, now)
 	}
 
-	proofPrefixed, _, err := domesticHolder.DiscloseWithTimeQREncoded(holderSk, cred, categoryMode, now)
 	if err != nil {
 		return WrappedErrorResult(err, "Could not disclosure credential")
 	}
@@ -152,6 +263,88 @@ func disclose(holderSkJson, credJson []byte, disclosurePolicy string, now time.T
 	return &Result{proofPrefixed, ""}
 }
 
+func checkDisclosurePolicy(disclosurePolicy string) error {
+	if _, ok := disclosureProfiles[disclosurePolicy]; ok {
+		return nil
+	}
+
+	_, err := DisclosureCategoryMode(disclosurePolicy)
+	return err
+}
+
+// DisclosureCategoryMode returns how the category is disclosed for the 1G and 3G disclosure policies,
+//  where the category is hidden for 3G. The fixtures disclose with the same mode as the holder
+func DisclosureCategoryMode(disclosurePolicy string) (int, error) {
+	if disclosurePolicy == DISCLOSURE_POLICY_1G {
+		return holder.CATEGORY_DISCLOSED_V3_SERIALIZATION, nil
+	} else if disclosurePolicy == DISCLOSURE_POLICY_3G {
+		return holder.CATEGORY_HIDDEN, nil
+	}
+
+	return 0, errors.Errorf("Unrecognized disclosure policy")
+}
+
+func holderSkFingerprint(holderSk *big.Int) string {
+	digest := sha256.Sum256(append([]byte(holderSkFingerprintContext), holderSk.Bytes()...))
+	return base64.StdEncoding.EncodeToString(digest[:16])
+}
+
+// checkHolderSkMatchesCredential returns the mismatch error when the credential wasn't issued to the holder sk.
+//  Matches are remembered, so the signature is only verified on the first disclosure of a credential.
+func checkHolderSkMatchesCredential(holderSk *big.Int, cred *gabi.Credential, credJson []byte) error {
+	digest := sha256.Sum256(append([]byte(holderSkFingerprint(holderSk)), credJson...))
+	key := string(digest[:])
+
+	matchedHolderSkCredentialsMutex.Lock()
+	isMatched := matchedHolderSkCredentials[key]
+	matchedHolderSkCredentialsMutex.Unlock()
+
+	if isMatched {
+		return nil
+	}
+
+	matches, err := holderSkMatchesCredential(holderSk, cred)
+	if err != nil {
+		return err
+	}
+
+	if !matches {
+		return errors.New(HOLDER_SK_MISMATCH_ERROR)
+	}
+
+	matchedHolderSkCredentialsMutex.Lock()
+	defer matchedHolderSkCredentialsMutex.Unlock()
+
+	// Start over instead of growing without bounds, as a holder only has a few credentials at a time
+	if len(matchedHolderSkCredentials) >= matchedHolderSkCredentialsMaximumAmount {
+		matchedHolderSkCredentials = map[string]bool{}
+	}
+
+	matchedHolderSkCredentials[key] = true
+	return nil
+}
+
+// holderSkMatchesCredential checks if the credential signature is valid over the holder secret key
+//  and the credential attributes, which is only the case for the holder sk it was issued to
+func holderSkMatchesCredential(holderSk *big.Int, cred *gabi.Credential) (bool, error) {
+	if len(cred.Attributes) < 2 || cred.Signature == nil {
+		return false, errors.Errorf("Invalid credential")
+	}
+
+	_, issuerPkId, _, err := idemixcommon.DecodeMetadataAttribute(cred.Attributes[1])
+	if err != nil {
+		return false, errors.WrapPrefix(err, "Could not decode metadata attribute", 0)
+	}
+
+	issuerPk, err := findDomesticHolderPk(issuerPkId)
+	if err != nil {
+		return false, errors.WrapPrefix(err, "Could not find issuer public key", 0)
+	}
+
+	ms := append([]*big.Int{holderSk}, cred.Attributes[1:]...)
+	return cred.Signature.Verify(issuerPk, ms), nil
+}
+
 func unmarshalHolderSk(holderSkJson []byte) (*big.Int, error) {
 	holderSk := new(big.Int)
 	err := json.Unmarshal(holderSkJson, holderSk)
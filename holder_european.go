@@ -57,3 +57,124 @@ func IsForeignDCC(proofQREncoded []byte) bool {
 
 	return false
 }
+
+type ForeignDCCExplanation struct {
+	IsForeignDCC      bool   `json:"isForeignDCC"`
+	IsCASIsland       bool   `json:"isCASIsland"`
+	IsNL              bool   `json:"isNL"`
+	CWTIssuer         string `json:"cwtIssuer"`
+	KeySubjectAltName string `json:"keySubjectAltName"`
+	Reason            string `json:"reason"`
+
+	// IssuerCountryCode is determined like the verifier does with the European verification rules of
+	//  the holder or verifier config, and is empty when neither is loaded and the signature is valid
+	IssuerCountryCode string `json:"issuerCountryCode"`
+
+	// PolicyResults is keyed by verification policy, and only present when the holder
+	//  config contains the European verification rules
+	PolicyResults map[string]*ForeignDCCPolicyResult `json:"policyResults,omitempty"`
+}
+
+type ForeignDCCPolicyResult struct {
+	Status int    `json:"status"`
+	Error  string `json:"error"`
+}
+
+const (
+	FOREIGN_DCC_REASON_FOREIGN_ISSUER = "foreignIssuer"
+	FOREIGN_DCC_REASON_CAS_ISLAND_KEY = "casIslandKey"
+	FOREIGN_DCC_REASON_DOMESTIC_KEY   = "domesticKey"
+	FOREIGN_DCC_REASON_UNKNOWN_KEY    = "unknownKey"
+	FOREIGN_DCC_REASON_INVALID_DCC    = "invalidDCC"
+)
+
+// ExplainForeignDCC returns why a DCC is or isn't considered foreign by IsForeignDCC, together with the
+//  issuer country and what the verifier would return for every verification policy
+func ExplainForeignDCC(proofQREncoded []byte) *Result {
+	return explainForeignDCC(proofQREncoded, time.Now())
+}
+
+func ExplainForeignDCCWithTime(proofQREncoded []byte, unixTimeSeconds int64) *Result {
+	return explainForeignDCC(proofQREncoded, time.Unix(unixTimeSeconds, 0))
+}
+
+func explainForeignDCC(proofQREncoded []byte, now time.Time) *Result {
+	explanation := buildForeignDCCExplanation(proofQREncoded, now)
+
+	explanationJson, err := json.Marshal(explanation)
+	if err != nil {
+		return WrappedErrorResult(err, "Could not JSON marshal foreign DCC explanation")
+	}
+
+	return &Result{explanationJson, ""}
+}
+
+func buildForeignDCCExplanation(proofQREncoded []byte, now time.Time) *ForeignDCCExplanation {
+	hcert, err := europeanHolder.ReadQREncoded(proofQREncoded)
+	if err != nil {
+		return &ForeignDCCExplanation{
+			Reason: FOREIGN_DCC_REASON_INVALID_DCC,
+		}
+	}
+
+	explanation := &ForeignDCCExplanation{
+		IsForeignDCC:      IsForeignDCC(proofQREncoded),
+		CWTIssuer:         hcert.Issuer,
+		IssuerCountryCode: hcert.Issuer,
+	}
+
+	// Without a verified signature, the key SAN and therefore the CAS-island status cannot be known
+	verified, err := europeanHolderVerifier.VerifyQREncoded(proofQREncoded)
+	if err != nil {
+		explanation.Reason = FOREIGN_DCC_REASON_UNKNOWN_KEY
+		if hcert.Issuer != DCC_DOMESTIC_ISSUER_COUNTRY_CODE {
+			explanation.Reason = FOREIGN_DCC_REASON_FOREIGN_ISSUER
+		}
+
+		return explanation
+	}
+
+	pk := verified.PublicKey
+	explanation.KeySubjectAltName = pk.SubjectAltName
+	explanation.IsNL = isNLIssuedDCC(verified.HealthCertificate, pk)
+	explanation.IsCASIsland = hcert.Issuer == DCC_DOMESTIC_ISSUER_COUNTRY_CODE && !explanation.IsNL
+
+	if hcert.Issuer != DCC_DOMESTIC_ISSUER_COUNTRY_CODE {
+		explanation.Reason = FOREIGN_DCC_REASON_FOREIGN_ISSUER
+	} else if explanation.IsCASIsland {
+		explanation.Reason = FOREIGN_DCC_REASON_CAS_ISLAND_KEY
+	} else {
+		explanation.Reason = FOREIGN_DCC_REASON_DOMESTIC_KEY
+	}
+
+	// Determine the issuer country in the same way the verifier does, which is unknown without rules
+	explanation.IssuerCountryCode = ""
+	if holderConfig == nil || holderConfig.EuropeanVerificationRules == nil {
+		if verifierConfig != nil && verifierConfig.EuropeanVerificationRules != nil {
+			explanation.IssuerCountryCode = determineIssuerCountryCode(verified.HealthCertificate, pk, verifierConfig.EuropeanVerificationRules)
+		}
+
+		return explanation
+	}
+
+	// The policy results are only determined with the rules of the holder config
+	rules := holderConfig.EuropeanVerificationRules
+	explanation.IssuerCountryCode = determineIssuerCountryCode(verified.HealthCertificate, pk, rules)
+
+	explanation.PolicyResults = map[string]*ForeignDCCPolicyResult{}
+	for _, policy := range []string{VERIFICATION_POLICY_1G, VERIFICATION_POLICY_3G} {
+		policyResult := &ForeignDCCPolicyResult{Status: VERIFICATION_SUCCESS}
+
+		_, _, isNLDCC, err := validateVerifiedEuropean(verified, policy, rules, now)
+		if err != nil {
+			policyResult.Status = VERIFICATION_FAILED_ERROR
+			policyResult.Error = err.Error()
+		} else if isNLDCC {
+			policyResult.Status = VERIFICATION_FAILED_IS_NL_DCC
+		}
+
+		explanation.PolicyResults[policy] = policyResult
+	}
+
+	return explanation
+}
@@ -0,0 +1,355 @@
+package mobilecore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"github.com/go-errors/errors"
+	idemixcommon "github.com/minvws/nl-covid19-coronacheck-idemix/common"
+	"github.com/privacybydesign/gabi"
+	"github.com/privacybydesign/gabi/big"
+	"io"
+	"strconv"
+)
+
+const (
+	ISSUANCE_STATE_KEY_SIZE = 32
+)
+
+type CreateCommitmentMessageWithStateResultValue struct {
+	IssueCommitmentMessage *gabi.IssueCommitmentMessage `json:"issueCommitmentMessage"`
+	IssuanceState          []byte                       `json:"issuanceState"`
+}
+
+// issuanceState contains everything but the holder secret key that is needed to construct
+//  the credentials after the issuer has responded to the commitments
+type issuanceState struct {
+	IssuerPkId string     `json:"issuerPkId"`
+	Nonce2     *big.Int   `json:"nonce2"`
+	VPrimes    []*big.Int `json:"vPrimes"`
+}
+
+// CreateCommitmentMessageWithState does the same as CreateCommitmentMessage, but instead of keeping
+//  the proof builders in memory, it returns them as issuance state encrypted under the given key.
+//  The state is bound to the issue specification message, and can be passed to CreateCredentialsWithState
+//  after an app restart.
+func CreateCommitmentMessageWithState(holderSkJson, issueSpecificationMessageJson, stateKey []byte) *Result {
+	holderSk, err := unmarshalHolderSk(holderSkJson)
+	if err != nil {
+		return ErrorResult(err)
+	}
+
+	ism, ismDigest, err := unmarshalIssueSpecificationMessage(issueSpecificationMessageJson)
+	if err != nil {
+		return ErrorResult(err)
+	}
+
+	issuerPk, err := findDomesticHolderPk(ism.IssuerPkId)
+	if err != nil {
+		return WrappedErrorResult(err, "Could not find issuer public key")
+	}
+
+	// Create the builders with fresh randomness, and keep that randomness as state
+	state := &issuanceState{
+		IssuerPkId: ism.IssuerPkId,
+		Nonce2:     idemixcommon.GenerateNonce(),
+		VPrimes:    make([]*big.Int, 0, ism.CredentialAmount),
+	}
+
+	credBuilders := make(gabi.ProofBuilderList, 0, ism.CredentialAmount)
+	for i := 0; i < ism.CredentialAmount; i++ {
+		vPrime := idemixcommon.RandomBigInt(issuerPk.Params.LvPrime)
+		state.VPrimes = append(state.VPrimes, vPrime)
+		credBuilders = append(credBuilders, newResumableCredentialBuilder(issuerPk, holderSk, state.Nonce2, vPrime))
+	}
+
+	icm := &gabi.IssueCommitmentMessage{
+		Proofs: credBuilders.BuildProofList(idemixcommon.BigOne, ism.IssuerNonce, false),
+		Nonce2: state.Nonce2,
+	}
+
+	// Serialize and encrypt the state
+	stateJson, err := json.Marshal(state)
+	if err != nil {
+		return WrappedErrorResult(err, "Could not marshal issuance state")
+	}
+
+	encryptedState, err := sealIssuanceState(stateKey, stateJson, ismDigest)
+	if err != nil {
+		return ErrorResult(err)
+	}
+
+	resultJson, err := json.Marshal(&CreateCommitmentMessageWithStateResultValue{
+		IssueCommitmentMessage: icm,
+		IssuanceState:          encryptedState,
+	})
+	if err != nil {
+		return WrappedErrorResult(err, "Could not marshal issue commitment message with state")
+	}
+
+	return &Result{resultJson, ""}
+}
+
+// CreateCredentialsWithState constructs the credentials from the issuance state that was returned by
+//  CreateCommitmentMessageWithState. The same holder secret key, issue specification message and
+//  state key must be provided.
+func CreateCredentialsWithState(holderSkJson, issueSpecificationMessageJson, issuanceStateCiphertext, stateKey, ccmsJson []byte) *Result {
+	holderSk, err := unmarshalHolderSk(holderSkJson)
+	if err != nil {
+		return ErrorResult(err)
+	}
+
+	_, ismDigest, err := unmarshalIssueSpecificationMessage(issueSpecificationMessageJson)
+	if err != nil {
+		return ErrorResult(err)
+	}
+
+	stateJson, err := openIssuanceState(stateKey, issuanceStateCiphertext, ismDigest)
+	if err != nil {
+		return ErrorResult(err)
+	}
+
+	state := &issuanceState{}
+	err = json.Unmarshal(stateJson, state)
+	if err != nil {
+		return WrappedErrorResult(err, "Could not unmarshal issuance state")
+	}
+
+	issuerPk, err := findDomesticHolderPk(state.IssuerPkId)
+	if err != nil {
+		return WrappedErrorResult(err, "Could not find issuer public key")
+	}
+
+	var ccms []*idemixcommon.CreateCredentialMessage
+	err = json.Unmarshal(ccmsJson, &ccms)
+	if err != nil {
+		return WrappedErrorResult(err, "Could not unmarshal create credential messages")
+	}
+
+	if len(ccms) > len(state.VPrimes) {
+		return ErrorResult(errors.Errorf("More credentials are being issued than there are proof builders"))
+	}
+
+	results := make([]*CreateCredentialResultValue, 0, len(ccms))
+	for i, ccm := range ccms {
+		credBuilder := newResumableCredentialBuilder(issuerPk, holderSk, state.Nonce2, state.VPrimes[i])
+		cred, err := credBuilder.constructCredential(ccm)
+		if err != nil {
+			return WrappedErrorResult(err, "Could not construct credential")
+		}
+
+		attributes, err := readCredentialWithVersion(cred)
+		if err != nil {
+			return ErrorResult(err)
+		}
+
+		if attributes["credentialVersion"] != strconv.Itoa(CREATE_CREDENTIAL_VERSION) {
+			return ErrorResult(errors.Errorf("Invalid credential version in freshly constructed credential"))
+		}
+
+		results = append(results, &CreateCredentialResultValue{
+			Credential:          cred,
+			Attributes:          attributes,
+			HolderSkFingerprint: holderSkFingerprint(holderSk),
+		})
+	}
+
+	resultsJson, err := json.Marshal(results)
+	if err != nil {
+		return WrappedErrorResult(err, "Could not marshal read credential result")
+	}
+
+	return &Result{resultsJson, ""}
+}
+
+// unmarshalIssueSpecificationMessage also returns a digest over the normalized message,
+//  so that formatting differences don't influence the binding of the issuance state
+func unmarshalIssueSpecificationMessage(ismJson []byte) (*idemixcommon.IssueSpecificationMessage, []byte, error) {
+	ism := &idemixcommon.IssueSpecificationMessage{}
+	err := json.Unmarshal(ismJson, ism)
+	if err != nil {
+		return nil, nil, errors.WrapPrefix(err, "Could not JSON unmarshal issue specification message", 0)
+	}
+
+	if ism.IssuerNonce == nil {
+		return nil, nil, errors.Errorf("The issue specification message did not contain an issuer nonce")
+	}
+
+	normalizedIsmJson, err := json.Marshal(ism)
+	if err != nil {
+		return nil, nil, errors.WrapPrefix(err, "Could not JSON marshal issue specification message", 0)
+	}
+
+	ismDigest := sha256.Sum256(normalizedIsmJson)
+	return ism, ismDigest[:], nil
+}
+
+// The issuance state is encrypted with AES-GCM, with the issue specification message digest as
+//  additional data. The random nonce is prepended to the ciphertext.
+func sealIssuanceState(stateKey, stateJson, ismDigest []byte) ([]byte, error) {
+	aead, err := newIssuanceStateAEAD(stateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not generate issuance state nonce", 0)
+	}
+
+	return aead.Seal(nonce, nonce, stateJson, ismDigest), nil
+}
+
+func openIssuanceState(stateKey, ciphertext, ismDigest []byte) ([]byte, error) {
+	aead, err := newIssuanceStateAEAD(stateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	nonceSize := aead.NonceSize()
+	if len(ciphertext) < nonceSize {
+		return nil, errors.Errorf("The issuance state is too short")
+	}
+
+	stateJson, err := aead.Open(nil, ciphertext[:nonceSize], ciphertext[nonceSize:], ismDigest)
+	if err != nil {
+		return nil, errors.Errorf("Could not decrypt issuance state with the given key and issue specification message")
+	}
+
+	return stateJson, nil
+}
+
+func newIssuanceStateAEAD(stateKey []byte) (cipher.AEAD, error) {
+	if len(stateKey) != ISSUANCE_STATE_KEY_SIZE {
+		return nil, errors.Errorf("The issuance state key must be %d bytes", ISSUANCE_STATE_KEY_SIZE)
+	}
+
+	block, err := aes.NewCipher(stateKey)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not create issuance state cipher", 0)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not create issuance state AEAD", 0)
+	}
+
+	return aead, nil
+}
+
+// resumableCredentialBuilder mirrors the gabi CredentialBuilder for the (non-keyshare, non-random blind)
+//  case that is used for domestic credentials. Unlike the gabi builder, its secret randomness can be
+//  provided, so that it can be reconstructed from a serialized issuance state. The gabi builder doesn't
+//  export its randomness, so TestResumableCredentialBuilder pins this copy to its behavior.
+type resumableCredentialBuilder struct {
+	pk     *gabi.PublicKey
+	secret *big.Int
+	nonce2 *big.Int
+	vPrime *big.Int
+	u      *big.Int
+
+	vPrimeCommit *big.Int
+	skRandomizer *big.Int
+	uCommit      *big.Int
+	proofPcomm   *gabi.ProofPCommitment
+}
+
+func newResumableCredentialBuilder(pk *gabi.PublicKey, secret, nonce2, vPrime *big.Int) *resumableCredentialBuilder {
+	// U = S^{vPrime} * R0^{secret}
+	u := new(big.Int).Exp(pk.S, vPrime, pk.N)
+	u.Mul(u, new(big.Int).Exp(pk.R[0], secret, pk.N))
+	u.Mod(u, pk.N)
+
+	return &resumableCredentialBuilder{
+		pk:      pk,
+		secret:  secret,
+		nonce2:  nonce2,
+		vPrime:  vPrime,
+		u:       u,
+		uCommit: big.NewInt(1),
+	}
+}
+
+func (b *resumableCredentialBuilder) Commit(randomizers map[string]*big.Int) []*big.Int {
+	b.skRandomizer = randomizers["secretkey"]
+	b.vPrimeCommit = idemixcommon.RandomBigInt(b.pk.Params.LvPrimeCommit)
+
+	// U_commit = U_commit * S^{v_prime_commit} * R_0^{s_commit}
+	sv := new(big.Int).Exp(b.pk.S, b.vPrimeCommit, b.pk.N)
+	r0s := new(big.Int).Exp(b.pk.R[0], b.skRandomizer, b.pk.N)
+	b.uCommit.Mul(b.uCommit, sv).Mul(b.uCommit, r0s)
+	b.uCommit.Mod(b.uCommit, b.pk.N)
+
+	ucomm := new(big.Int).Set(b.u)
+	if b.proofPcomm != nil {
+		ucomm.Mul(ucomm, b.proofPcomm.P).Mod(ucomm, b.pk.N)
+	}
+
+	return []*big.Int{ucomm, b.uCommit}
+}
+
+func (b *resumableCredentialBuilder) CreateProof(challenge *big.Int) gabi.Proof {
+	sResponse := new(big.Int).Add(b.skRandomizer, new(big.Int).Mul(challenge, b.secret))
+	vPrimeResponse := new(big.Int).Add(b.vPrimeCommit, new(big.Int).Mul(challenge, b.vPrime))
+
+	return &gabi.ProofU{
+		U:              b.u,
+		C:              challenge,
+		VPrimeResponse: vPrimeResponse,
+		SResponse:      sResponse,
+		MUserResponses: map[int]*big.Int{},
+	}
+}
+
+func (b *resumableCredentialBuilder) PublicKey() *gabi.PublicKey {
+	return b.pk
+}
+
+func (b *resumableCredentialBuilder) MergeProofPCommitment(commitment *gabi.ProofPCommitment) {
+	b.proofPcomm = commitment
+	b.uCommit.Mod(
+		b.uCommit.Mul(b.uCommit, commitment.Pcommit),
+		b.pk.N,
+	)
+}
+
+func (b *resumableCredentialBuilder) constructCredential(ccm *idemixcommon.CreateCredentialMessage) (*gabi.Credential, error) {
+	msg := ccm.IssueSignatureMessage
+	if msg == nil || msg.Proof == nil || msg.Signature == nil {
+		return nil, errors.Errorf("The create credential message did not contain an issue signature message")
+	}
+
+	if !msg.Proof.Verify(b.pk, msg.Signature, idemixcommon.BigOne, b.nonce2) {
+		return nil, gabi.ErrIncorrectProofOfSignatureCorrectness
+	}
+
+	attributeTypes := idemixcommon.AttributeTypes[CREATE_CREDENTIAL_VERSION]
+	attributeInts, err := idemixcommon.ComputeAttributeInts(attributeTypes, ccm.Attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Construct the actual signature, and verify it over the secret key and attributes
+	signature := &gabi.CLSignature{
+		A: msg.Signature.A,
+		E: msg.Signature.E,
+		V: new(big.Int).Add(msg.Signature.V, b.vPrime),
+	}
+
+	ms := append([]*big.Int{b.secret}, attributeInts...)
+	if !signature.Verify(b.pk, ms) {
+		return nil, gabi.ErrIncorrectAttributeSignature
+	}
+
+	// Remove holder secret key from credential attributes
+	ms[0] = nil
+
+	return &gabi.Credential{
+		Pk:         b.pk,
+		Signature:  signature,
+		Attributes: ms,
+	}, nil
+}
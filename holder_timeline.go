@@ -0,0 +1,209 @@
+package mobilecore
+
+import (
+	"encoding/json"
+	"github.com/go-errors/errors"
+	"sort"
+	"time"
+)
+
+const (
+	TIMELINE_TRANSITION_BECOMES_VALID   = "becomesValid"
+	TIMELINE_TRANSITION_EXPIRES         = "expires"
+	TIMELINE_TRANSITION_BATCH_EXHAUSTED = "batchExhausted"
+)
+
+// HolderWallet contains the credentials for which a timeline is requested. Domestic credentials are
+//  grouped in the batches they were issued in, and European credentials are given as QR-code.
+type HolderWallet struct {
+	DomesticCredentialBatches []*HolderWalletDomesticBatch      `json:"domesticCredentialBatches"`
+	EuropeanCredentials       []*HolderWalletEuropeanCredential `json:"europeanCredentials"`
+}
+
+type HolderWalletDomesticBatch struct {
+	Id          string            `json:"id"`
+	Credentials []json.RawMessage `json:"credentials"`
+}
+
+type HolderWalletEuropeanCredential struct {
+	Id string `json:"id"`
+	QR string `json:"qr"`
+}
+
+// TimelineEntry is a single future state change of a credential for a verification policy. For domestic
+//  credentials, the credential index denotes the credential within the batch. The expiry of the last
+//  valid credential in a batch is reported both as expiry and as the batch being exhausted.
+type TimelineEntry struct {
+	UnixTimeSeconds int64  `json:"unixTimeSeconds"`
+	CredentialId    string `json:"credentialId"`
+	CredentialIndex int    `json:"credentialIndex"`
+	Policy          string `json:"policy"`
+	Transition      string `json:"transition"`
+}
+
+// HolderTimeline returns the upcoming state changes of the credentials in the given wallet JSON,
+//  sorted by time, using the same rules as the verifier
+func HolderTimeline(walletJson []byte) *Result {
+	return holderTimeline(walletJson, time.Now())
+}
+
+func HolderTimelineWithTime(walletJson []byte, unixTimeSeconds int64) *Result {
+	return holderTimeline(walletJson, time.Unix(unixTimeSeconds, 0))
+}
+
+func holderTimeline(walletJson []byte, now time.Time) *Result {
+	wallet := &HolderWallet{}
+	err := json.Unmarshal(walletJson, wallet)
+	if err != nil {
+		return WrappedErrorResult(err, "Could not JSON unmarshal wallet")
+	}
+
+	entries, err := buildTimeline(wallet, now)
+	if err != nil {
+		return ErrorResult(err)
+	}
+
+	entriesJson, err := json.Marshal(entries)
+	if err != nil {
+		return WrappedErrorResult(err, "Could not JSON marshal timeline")
+	}
+
+	return &Result{entriesJson, ""}
+}
+
+func buildTimeline(wallet *HolderWallet, now time.Time) ([]*TimelineEntry, error) {
+	entries := []*TimelineEntry{}
+
+	for _, batch := range wallet.DomesticCredentialBatches {
+		batchEntries, err := buildDomesticBatchTimeline(batch, now)
+		if err != nil {
+			return nil, errors.WrapPrefix(err, "Could not build timeline for domestic batch "+batch.Id, 0)
+		}
+
+		entries = append(entries, batchEntries...)
+	}
+
+	if len(wallet.EuropeanCredentials) > 0 && (holderConfig == nil || holderConfig.EuropeanVerificationRules == nil) {
+		return nil, errors.Errorf("The holder config does not contain the European verification rules")
+	}
+
+	for _, europeanCredential := range wallet.EuropeanCredentials {
+		europeanEntries, err := buildEuropeanTimeline(europeanCredential, holderConfig.EuropeanVerificationRules, now)
+		if err != nil {
+			return nil, errors.WrapPrefix(err, "Could not build timeline for European credential "+europeanCredential.Id, 0)
+		}
+
+		entries = append(entries, europeanEntries...)
+	}
+
+	// The entries are built in a deterministic order, so a stable sort on time suffices
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].UnixTimeSeconds < entries[j].UnixTimeSeconds
+	})
+
+	return entries, nil
+}
+
+func buildDomesticBatchTimeline(batch *HolderWalletDomesticBatch, now time.Time) ([]*TimelineEntry, error) {
+	entries := []*TimelineEntry{}
+	batchValidUntil := map[string]time.Time{}
+	batchLastIndex := map[string]int{}
+
+	for i, credJson := range batch.Credentials {
+		cred, err := unmarshalCredential(credJson)
+		if err != nil {
+			return nil, err
+		}
+
+		attributes, err := readCredentialWithVersion(cred)
+		if err != nil {
+			return nil, err
+		}
+
+		validFrom, validUntil, err := domesticValidity(attributes["validFrom"], attributes["validForHours"])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, policy := range []string{VERIFICATION_POLICY_1G, VERIFICATION_POLICY_3G} {
+			if checkPolicy(policy, attributes) != nil {
+				continue
+			}
+
+			entries = appendValidityEntries(entries, batch.Id, i, policy, validFrom, validUntil, now)
+			if validUntil.After(batchValidUntil[policy]) {
+				batchValidUntil[policy] = validUntil
+				batchLastIndex[policy] = i
+			}
+		}
+	}
+
+	for _, policy := range []string{VERIFICATION_POLICY_1G, VERIFICATION_POLICY_3G} {
+		validUntil, ok := batchValidUntil[policy]
+		if ok && validUntil.After(now) {
+			entries = append(entries, &TimelineEntry{
+				UnixTimeSeconds: validUntil.Unix(),
+				CredentialId:    batch.Id,
+				CredentialIndex: batchLastIndex[policy],
+				Policy:          policy,
+				Transition:      TIMELINE_TRANSITION_BATCH_EXHAUSTED,
+			})
+		}
+	}
+
+	return entries, nil
+}
+
+func buildEuropeanTimeline(europeanCredential *HolderWalletEuropeanCredential, rules *europeanVerificationRules, now time.Time) ([]*TimelineEntry, error) {
+	hcert, err := europeanHolder.ReadQREncoded([]byte(europeanCredential.QR))
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not read European credential", 0)
+	}
+
+	validFrom, validUntil, err := dccValidity(hcert, rules)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []*TimelineEntry{}
+	if !validUntil.After(now) || validUntil.Before(validFrom) {
+		return entries, nil
+	}
+
+	// Validate the DCC at a moment within its validity period, so that statements that are never
+	//  accepted (for instance vaccinations under the 1G policy) don't show up in the timeline
+	probeTime := latestTime(validFrom, now)
+	for _, policy := range []string{VERIFICATION_POLICY_1G, VERIFICATION_POLICY_3G} {
+		if validateDCC(hcert.DCC, policy, rules, probeTime) != nil {
+			continue
+		}
+
+		entries = appendValidityEntries(entries, europeanCredential.Id, 0, policy, validFrom, validUntil, now)
+	}
+
+	return entries, nil
+}
+
+func appendValidityEntries(entries []*TimelineEntry, id string, index int, policy string, validFrom, validUntil, now time.Time) []*TimelineEntry {
+	if validFrom.After(now) {
+		entries = append(entries, &TimelineEntry{
+			UnixTimeSeconds: validFrom.Unix(),
+			CredentialId:    id,
+			CredentialIndex: index,
+			Policy:          policy,
+			Transition:      TIMELINE_TRANSITION_BECOMES_VALID,
+		})
+	}
+
+	if validUntil.After(now) {
+		entries = append(entries, &TimelineEntry{
+			UnixTimeSeconds: validUntil.Unix(),
+			CredentialId:    id,
+			CredentialIndex: index,
+			Policy:          policy,
+			Transition:      TIMELINE_TRANSITION_EXPIRES,
+		})
+	}
+
+	return entries
+}
@@ -0,0 +1,68 @@
+package mobilecore
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestMatchIdentity(t *testing.T) {
+	td3 := "P<UTOERIKSSON<<ANNA<MARIA<<<<<<<<<<<<<<<<<<<\nL898902C36UTO7408122F1204159ZE184226B<<<<<10"
+	td1 := "I<UTOD231458907<<<<<<<<<<<<<<<\n7408122F1204159UTO<<<<<<<<<<<6\nERIKSSON<<ANNA<MARIA<<<<<<<<<<"
+	details := &VerificationDetails{FirstNameInitial: "A", LastNameInitial: "E", BirthDay: "12", BirthMonth: "08"}
+	unknownBirthDayDetails := &VerificationDetails{FirstNameInitial: "A", LastNameInitial: "E", BirthDay: "XX", BirthMonth: "08"}
+	umlautDetails := &VerificationDetails{FirstNameInitial: "A", LastNameInitial: "O", BirthDay: "12", BirthMonth: "8"}
+
+	testCases := []struct {
+		details          *VerificationDetails
+		identityDocument *IdentityDocument
+		expected         *IdentityMatchResultValue
+	}{
+		{details, &IdentityDocument{MRZ: td3}, &IdentityMatchResultValue{IDENTITY_MATCH, []string{}, []string{}}},
+		{details, &IdentityDocument{MRZ: td1}, &IdentityMatchResultValue{IDENTITY_MATCH, []string{}, []string{}}},
+		{details, &IdentityDocument{FirstName: "Ánna", LastName: "Eriksson", DateOfBirth: "1974-08-13"},
+			&IdentityMatchResultValue{IDENTITY_MISMATCH, []string{"birthDay"}, []string{}}},
+		{details, &IdentityDocument{FirstName: "Anna", LastName: "Eriksson", DateOfBirth: "1974-08"},
+			&IdentityMatchResultValue{IDENTITY_PARTIAL, []string{}, []string{"birthDay"}}},
+		{unknownBirthDayDetails, &IdentityDocument{MRZ: td3}, &IdentityMatchResultValue{IDENTITY_PARTIAL, []string{}, []string{"birthDay"}}},
+
+		// ICAO transliteration of Ö is OE, so the initial is O
+		{umlautDetails, &IdentityDocument{FirstName: "anna", LastName: "Öztürk", DateOfBirth: "1974-08-12"},
+			&IdentityMatchResultValue{IDENTITY_MATCH, []string{}, []string{}}},
+		{umlautDetails, &IdentityDocument{FirstName: "Bram", LastName: "Østergaard", DateOfBirth: "1974-08-12"},
+			&IdentityMatchResultValue{IDENTITY_MISMATCH, []string{"firstNameInitial"}, []string{}}},
+	}
+
+	for i, testCase := range testCases {
+		identityDocumentJson, err := json.Marshal(testCase.identityDocument)
+		if err != nil {
+			t.Fatal("Could not JSON marshal identity document:", err)
+		}
+
+		r1 := MatchIdentity(testCase.details, identityDocumentJson)
+		if r1.Error != "" {
+			t.Fatal("Could not match identity for test case", i, r1.Error)
+		}
+
+		result := &IdentityMatchResultValue{}
+		err = json.Unmarshal(r1.Value, result)
+		if err != nil {
+			t.Fatal("Could not unmarshal identity match:", err)
+		}
+
+		if !reflect.DeepEqual(result, testCase.expected) {
+			t.Fatal("Unexpected identity match for test case", i, result)
+		}
+	}
+
+	// An invalid check digit should be detected
+	invalidMRZ, err := json.Marshal(&IdentityDocument{MRZ: "P<UTOERIKSSON<<ANNA<MARIA<<<<<<<<<<<<<<<<<<<L898902C36UTO7408123F1204159ZE184226B<<<<<10"})
+	if err != nil {
+		t.Fatal("Could not JSON marshal identity document:", err)
+	}
+
+	r2 := MatchIdentity(details, invalidMRZ)
+	if r2.Error == "" {
+		t.Fatal("An MRZ with an invalid check digit should not be accepted")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	hcertverifier "github.com/minvws/nl-covid19-coronacheck-hcert/verifier"
 	"github.com/privacybydesign/gabi"
 	"os"
+	"sync"
 )
 
 type PublicKeysConfig struct {
@@ -22,6 +23,10 @@ type AnnotatedDomesticPk struct {
 	PkXml    []byte          `json:"public_key"`
 	LoadedPk *gabi.PublicKey `json:"-"`
 
+	// The public key is loaded once, as verifications and disclosures can find it concurrently
+	loadOnce sync.Once
+	loadErr  error
+
 	// DEPRECATED: Remove this field together with LegacyDomesticPks
 	KID string `json:"id"`
 }
@@ -63,12 +68,12 @@ func (pkc *PublicKeysConfig) FindAndCacheDomestic(kid string) (*gabi.PublicKey,
 	}
 
 	// Ensure the public key is cached
-	if annotatedPk.LoadedPk == nil {
-		var err error
-		annotatedPk.LoadedPk, err = gabi.NewPublicKeyFromBytes(annotatedPk.PkXml)
-		if err != nil {
-			return nil, errors.WrapPrefix(err, "Could not XML unmarshal and load domestic issuer public key", 0)
-		}
+	annotatedPk.loadOnce.Do(func() {
+		annotatedPk.LoadedPk, annotatedPk.loadErr = gabi.NewPublicKeyFromBytes(annotatedPk.PkXml)
+	})
+
+	if annotatedPk.loadErr != nil {
+		return nil, errors.WrapPrefix(annotatedPk.loadErr, "Could not XML unmarshal and load domestic issuer public key", 0)
 	}
 
 	return annotatedPk.LoadedPk, nil
@@ -0,0 +1,163 @@
+// Package qrimage detects and decodes QR codes in PNG and JPEG images, like screenshots and
+//  photos of QR codes that are attached to bug reports
+package qrimage
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/makiuchi-d/gozxing"
+	multiqrcode "github.com/makiuchi-d/gozxing/multi/qrcode"
+	"github.com/makiuchi-d/gozxing/qrcode"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var imageExtensions = map[string]bool{
+	".png":  true,
+	".jpg":  true,
+	".jpeg": true,
+}
+
+// DecodedQR is a single QR code in an image file, where the index orders the codes in the image
+//  from top to bottom and left to right. When an image in a directory could not be decoded,
+//  there is a single DecodedQR for that image with only the path and error.
+type DecodedQR struct {
+	Path    string `json:"path"`
+	Index   int    `json:"index"`
+	Content string `json:"content"`
+	Error   string `json:"error,omitempty"`
+}
+
+// DecodePath decodes all QR codes in an image file, or in the image files directly within a directory.
+//  An image in a directory that can't be decoded doesn't stop the others from being decoded.
+func DecodePath(path string) ([]*DecodedQR, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not stat path", 0)
+	}
+
+	if !info.IsDir() {
+		return DecodeFile(path)
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not read directory", 0)
+	}
+
+	decodedQRs := []*DecodedQR{}
+	for _, entry := range entries {
+		if entry.IsDir() || !imageExtensions[strings.ToLower(filepath.Ext(entry.Name()))] {
+			continue
+		}
+
+		filePath := filepath.Join(path, entry.Name())
+		fileQRs, err := DecodeFile(filePath)
+		if err != nil {
+			decodedQRs = append(decodedQRs, &DecodedQR{Path: filePath, Error: err.Error()})
+			continue
+		}
+
+		decodedQRs = append(decodedQRs, fileQRs...)
+	}
+
+	return decodedQRs, nil
+}
+
+// DecodeFile decodes all QR codes in a PNG or JPEG file
+func DecodeFile(path string) ([]*DecodedQR, error) {
+	imageFile, err := os.Open(path)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not open image file", 0)
+	}
+
+	defer imageFile.Close()
+
+	img, _, err := image.Decode(imageFile)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not decode image "+path, 0)
+	}
+
+	contents, err := DecodeImage(img)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not decode QR codes in "+path, 0)
+	}
+
+	decodedQRs := make([]*DecodedQR, 0, len(contents))
+	for i, content := range contents {
+		decodedQRs = append(decodedQRs, &DecodedQR{
+			Path:    path,
+			Index:   i,
+			Content: content,
+		})
+	}
+
+	return decodedQRs, nil
+}
+
+// DecodeImage returns the contents of all QR codes in the image, ordered from top to bottom and left to right.
+//  An error is returned when no QR code could be found.
+func DecodeImage(img image.Image) ([]string, error) {
+	bitmap, err := gozxing.NewBinaryBitmapFromImage(img)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not binarize image", 0)
+	}
+
+	hints := map[gozxing.DecodeHintType]interface{}{
+		gozxing.DecodeHintType_TRY_HARDER: true,
+	}
+
+	// The multi detector can miss a single code that fills the image, so fall back to the single reader
+	results, err := multiqrcode.NewQRCodeMultiReader().DecodeMultiple(bitmap, hints)
+	if err != nil || len(results) == 0 {
+		result, err := qrcode.NewQRCodeReader().Decode(bitmap, hints)
+		if err != nil {
+			return nil, errors.WrapPrefix(err, "No QR code was found", 0)
+		}
+
+		results = []*gozxing.Result{result}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		iX, iY := topLeft(results[i])
+		jX, jY := topLeft(results[j])
+		if iY != jY {
+			return iY < jY
+		}
+
+		return iX < jX
+	})
+
+	contents := make([]string, 0, len(results))
+	for _, result := range results {
+		contents = append(contents, result.GetText())
+	}
+
+	return contents, nil
+}
+
+// topLeft returns the smallest coordinates of the finder patterns, rounded to rows of 100 pixels
+//  so that codes next to each other are ordered from left to right despite small offsets
+func topLeft(result *gozxing.Result) (x, y int) {
+	points := result.GetResultPoints()
+	if len(points) == 0 {
+		return 0, 0
+	}
+
+	minX, minY := points[0].GetX(), points[0].GetY()
+	for _, point := range points[1:] {
+		if point.GetX() < minX {
+			minX = point.GetX()
+		}
+
+		if point.GetY() < minY {
+			minY = point.GetY()
+		}
+	}
+
+	return int(minX), int(minY) / 100
+}
@@ -0,0 +1,98 @@
+package qrimage
+
+import (
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/qrcode"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	firstContent  = "HC1:NCFA20690T9WTWGVLK-49NJ3B0J$OCC*AX*4FBBD%1*702T9DN03E53F3560+$GY50.FK8ZKO/EZKEZ967L6C56GVC"
+	secondContent = "NL2:B4Z/*BB%FSJ$XW%ZS8VIW0NG:0+T89XJ%3.IPZ/OF$K1T$6VW0$IPNB82/VIDRO*9XO6PT:/8P7KQ-NKWNIKPZ"
+)
+
+func TestDecodePath(t *testing.T) {
+	dir := t.TempDir()
+
+	// Two codes next to each other in one image, and a single code in another
+	writeImage(t, filepath.Join(dir, "multiple.png"), firstContent, secondContent)
+	writeImage(t, filepath.Join(dir, "single.png"), secondContent)
+
+	err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not an image"), 0600)
+	if err != nil {
+		t.Fatal("Could not write text file", err)
+	}
+
+	// An image without QR codes shouldn't stop the other images from being decoded
+	emptyPath := filepath.Join(dir, "empty.png")
+	writeImage(t, emptyPath)
+
+	decodedQRs, err := DecodePath(dir)
+	if err != nil {
+		t.Fatal("Could not decode directory", err)
+	}
+
+	if len(decodedQRs) != 4 || decodedQRs[0].Path != emptyPath || decodedQRs[0].Error == "" {
+		t.Fatal("Expected an error for the image without QR codes")
+	}
+
+	expected := []*DecodedQR{
+		{filepath.Join(dir, "multiple.png"), 0, firstContent, ""},
+		{filepath.Join(dir, "multiple.png"), 1, secondContent, ""},
+		{filepath.Join(dir, "single.png"), 0, secondContent, ""},
+	}
+
+	for i, decodedQR := range decodedQRs[1:] {
+		if *decodedQR != *expected[i] {
+			t.Fatal("Unexpected decoded QR code", i, decodedQR.Path, decodedQR.Index, decodedQR.Content, decodedQR.Error)
+		}
+	}
+
+	// Decoding only an image without QR codes is an error
+	_, err = DecodePath(emptyPath)
+	if err == nil {
+		t.Fatal("Decoding an image without QR codes should fail")
+	}
+}
+
+func writeImage(t *testing.T, path string, contents ...string) {
+	const size = 400
+
+	img := image.NewGray(image.Rect(0, 0, size*(len(contents)+1), size))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	for i, content := range contents {
+		matrix, err := qrcode.NewQRCodeWriter().Encode(content, gozxing.BarcodeFormat_QR_CODE, size, size, nil)
+		if err != nil {
+			t.Fatal("Could not encode QR code", err)
+		}
+
+		// Offset every code a bit vertically, as codes in a photo are rarely aligned
+		offsetX, offsetY := i*size+size/4, i*10
+		for y := 0; y < matrix.GetHeight(); y++ {
+			for x := 0; x < matrix.GetWidth(); x++ {
+				if matrix.Get(x, y) && y+offsetY < size {
+					img.SetGray(x+offsetX, y+offsetY, color.Gray{Y: 0})
+				}
+			}
+		}
+	}
+
+	imageFile, err := os.Create(path)
+	if err != nil {
+		t.Fatal("Could not create image file", err)
+	}
+
+	defer imageFile.Close()
+
+	err = png.Encode(imageFile, img)
+	if err != nil {
+		t.Fatal("Could not encode image", err)
+	}
+}
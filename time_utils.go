@@ -18,8 +18,13 @@ func truncateDateString(value string) string {
 }
 
 func parseDate(value string) (time.Time, error) {
+	return parseDateInLocation(value, time.UTC)
+}
+
+// parseDateInLocation interprets a date-only value as the start of that calendar day in the given location
+func parseDateInLocation(value string, loc *time.Location) (time.Time, error) {
 	truncatedValue := truncateDateString(value)
-	return time.Parse(YYYYMMDD_FORMAT, truncatedValue)
+	return time.ParseInLocation(YYYYMMDD_FORMAT, truncatedValue, loc)
 }
 
 func parseDateOfBirth(value string) (year, month, day string, err error) {
@@ -36,7 +41,7 @@ func parseDateOfBirth(value string) (year, month, day string, err error) {
 
 // Parses the birthdate to a time value and takes the highest / most recent values for the month and day
 //  in case those values are unknown, but takes an old year if the year is unknown
-func mostRecentDOBDayMonth(value string) (time.Time, error) {
+func mostRecentDOBDayMonth(value string, loc *time.Location) (time.Time, error) {
 	year, month, day, err := parseDateOfBirth(value)
 	if err != nil {
 		return time.Time{}, errors.WrapPrefix(err, "Could not parse date of birth", 0)
@@ -59,7 +64,7 @@ func mostRecentDOBDayMonth(value string) (time.Time, error) {
 		day = strconv.Itoa(dayNumber)
 	}
 
-	dobTime, err := parseDate(fmt.Sprintf("%s-%s-%s", year, month, day))
+	dobTime, err := parseDateInLocation(fmt.Sprintf("%s-%s-%s", year, month, day), loc)
 	if err != nil {
 		return time.Time{}, errors.WrapPrefix(err, "Could not parse most recent date of birth", 0)
 	}
@@ -67,6 +72,28 @@ func mostRecentDOBDayMonth(value string) (time.Time, error) {
 	return dobTime, nil
 }
 
+func latestTime(first time.Time, others ...time.Time) time.Time {
+	latest := first
+	for _, other := range others {
+		if other.After(latest) {
+			latest = other
+		}
+	}
+
+	return latest
+}
+
+func earliestTime(first time.Time, others ...time.Time) time.Time {
+	earliest := first
+	for _, other := range others {
+		if other.Before(earliest) {
+			earliest = other
+		}
+	}
+
+	return earliest
+}
+
 // Unfortunately time.Time doesn't export daysIn, so we have to copy a fair amount of it,
 //  although we'll change some types
 var daysBefore = [...]int32{
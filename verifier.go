@@ -11,6 +11,9 @@ import (
 	"os"
 	"path"
 	"time"
+
+	// Embed the time zone database, as mobile platforms don't provide it in a location Go can read
+	_ "time/tzdata"
 )
 
 const (
@@ -23,6 +26,8 @@ const (
 	VERIFICATION_FAILED_UNRECOGNIZED_PREFIX
 	VERIFICATION_FAILED_IS_NL_DCC
 	VERIFICATION_FAILED_ERROR
+	VERIFICATION_FAILED_SCAN_LOCKED
+	VERIFICATION_FAILED_REPLAYED
 )
 
 const (
@@ -30,10 +35,21 @@ const (
 	VERIFICATION_POLICY_3G = "3"
 )
 
+const (
+	// VALIDITY_INDEFINITE is used as valid until for holders that are exempt from having a valid proof
+	VALIDITY_INDEFINITE = "indefinite"
+)
+
 type VerificationResult struct {
 	Status  int
 	Details *VerificationDetails
 	Error   string
+
+	// ScanLockWarning is set when the scan log is enabled and this scan switched verification policy
+	ScanLockWarning bool
+
+	// FullDetails is only set by full-detail verification
+	FullDetails *FullVerificationDetails
 }
 
 // VerificationDetails very much mimics the domestic verifier attributes, with only string type values,
@@ -47,22 +63,86 @@ type VerificationDetails struct {
 	LastNameInitial  string `json:"lastNameInitial"`
 	BirthDay         string `json:"birthDay"`
 	BirthMonth       string `json:"birthMonth"`
+
+	// DisclosureProfile is only set for domestic proofs that have been disclosed with a disclosure profile,
+	//  in which case the attributes that weren't disclosed are empty
+	DisclosureProfile string `json:"disclosureProfile"`
+
+	// UsedStatement is only set for DCCs with multiple statements, and denotes the statement that was
+	//  used for verification by its type and index, like vaccination:1
+	UsedStatement string `json:"usedStatement"`
+
+	// DoseClassification is only set when a DCC is verified by a vaccination statement,
+	//  and is one of the DOSE_CLASSIFICATION values
+	DoseClassification string `json:"doseClassification"`
+
+	// ValidFrom and ValidUntil are the unix timestamps of the period in which the proof is valid,
+	//  where valid until is VALIDITY_INDEFINITE for holders that are exempt from having a valid proof
+	ValidFrom  string `json:"validFrom"`
+	ValidUntil string `json:"validUntil"`
+}
+
+// FullVerificationDetails contains the content of a verified DCC for border control, with the statement
+//  fields only set for the type of statement that was used for verification
+type FullVerificationDetails struct {
+	FamilyName             string `json:"familyName"`
+	StandardizedFamilyName string `json:"standardizedFamilyName"`
+	GivenName              string `json:"givenName"`
+	StandardizedGivenName  string `json:"standardizedGivenName"`
+	DateOfBirth            string `json:"dateOfBirth"`
+
+	StatementType      string `json:"statementType"`
+	CountryOfStatement string `json:"countryOfStatement"`
+	CertificateIssuer  string `json:"certificateIssuer"`
+
+	MedicinalProduct   string `json:"medicinalProduct"`
+	Manufacturer       string `json:"manufacturer"`
+	DoseNumber         string `json:"doseNumber"`
+	TotalSeriesOfDoses string `json:"totalSeriesOfDoses"`
+	DateOfVaccination  string `json:"dateOfVaccination"`
+
+	TypeOfTest              string `json:"typeOfTest"`
+	TestName                string `json:"testName"`
+	TestNameAndManufacturer string `json:"testNameAndManufacturer"`
+	DateTimeOfCollection    string `json:"dateTimeOfCollection"`
+
+	DateOfFirstPositiveTest string `json:"dateOfFirstPositiveTest"`
+	CertificateValidFrom    string `json:"certificateValidFrom"`
+	CertificateValidUntil   string `json:"certificateValidUntil"`
 }
 
 type verifierConfiguration struct {
 	DomesticVerificationRules *domesticVerificationRules
 	EuropeanVerificationRules *europeanVerificationRules
+
+	// The scan log and scan lock are only used after calling EnableScanLog
+	ScanLockSeconds        int64 `json:"scanLockSeconds"`
+	ScanLockWarningSeconds int64 `json:"scanLockWarningSeconds"`
+	ScanLogStorageSeconds  int64 `json:"scanLogStorageSeconds"`
+
+	ClockDeviationThresholdSeconds int64 `json:"clockDeviationThresholdSeconds"`
 }
 
 type domesticVerificationRules struct {
 	QRValidForSeconds       int             `json:"qrValidForSeconds"`
 	ProofIdentifierDenylist map[string]bool `json:"proofIdentifierDenylist"`
+
+	// PolicyRequiredAttributes lists per verification policy which attributes must be disclosed.
+	//  Policies that aren't present require all identity attributes.
+	PolicyRequiredAttributes map[string][]string `json:"policyRequiredAttributes"`
 }
 
 type europeanVerificationRules struct {
 	TestAllowedTypes  []string `json:"testAllowedTypes"`
 	TestValidityHours int      `json:"testValidityHours"`
 
+	// TestValidityHoursPerType overrides the test validity for specific test types, like NAAT or RAT
+	TestValidityHoursPerType map[string]int `json:"testValidityHoursPerType"`
+
+	// RapidTestAllowedManufacturers lists the device identifiers of the EU common list of rapid antigen tests
+	//  that are accepted. When the list is empty, the device of a rapid test isn't checked.
+	RapidTestAllowedManufacturers []string `json:"rapidTestAllowedManufacturers"`
+
 	VaccinationValidityDelayDays          int      `json:"vaccinationValidityDelayDays"`
 	VaccinationJanssenValidityDelayDays   int      `json:"vaccinationJanssenValidityDelayDays"`
 	VaccinationValidityDays               int      `json:"vaccinationValidityDays"`
@@ -73,12 +153,49 @@ type europeanVerificationRules struct {
 	RecoveryValidFromDays  int `json:"recoveryValidFromDays"`
 	RecoveryValidUntilDays int `json:"recoveryValidUntilDays"`
 
+	// MultipleStatementsMode determines how DCCs with more than one statement are handled, and rejects them by default
+	MultipleStatementsMode string `json:"multipleStatementsMode"`
+
 	IssuerCountryCodeFromCASIslandSAN map[string]string `json:"issuerCountryCodeFromCASIslandSAN"`
 	CorrectedIssuerCountryCodes       map[string]string `json:"correctedIssuerCountryCodes"`
 
 	ProofIdentifierDenylist map[string]bool `json:"proofIdentifierDenylist"`
 
+	// FullDetailVerificationEnabled allows verifying with the full DCC content, for border control
+	FullDetailVerificationEnabled bool `json:"fullDetailVerificationEnabled"`
+
+	// AgeBrackets change the statement acceptance and validity for holders of a certain age,
+	//  where the first bracket the holder is certain to be in applies
+	AgeBrackets []*ageBracket `json:"ageBrackets"`
+
+	// EvaluationTimeZone is the IANA time zone (like Europe/Amsterdam) in which date-only fields are
+	//  interpreted as calendar days, which is UTC when absent
+	EvaluationTimeZone string `json:"evaluationTimeZone"`
+
 	vaccinationValidityIntoForceDate time.Time
+	evaluationLocation               *time.Location
+}
+
+func (rules *europeanVerificationRules) prepare() error {
+	// Load time zone once, as date-only fields would be interpreted wrongly with another one
+	evaluationLocation, err := time.LoadLocation(rules.EvaluationTimeZone)
+	if err != nil {
+		return errors.WrapPrefix(err, "Could not load evaluation time zone", 0)
+	}
+
+	rules.evaluationLocation = evaluationLocation
+
+	// Parse date once (and leave at default value if parsing goes awry)
+	rules.vaccinationValidityIntoForceDate, _ = time.ParseInLocation(YYYYMMDD_FORMAT, rules.VaccinationValidityIntoForceDateStr, rules.location())
+	return nil
+}
+
+func (rules *europeanVerificationRules) location() *time.Location {
+	if rules.evaluationLocation == nil {
+		return time.UTC
+	}
+
+	return rules.evaluationLocation
 }
 
 var (
@@ -86,6 +203,9 @@ var (
 
 	domesticVerifier *idemixverifier.Verifier
 	europeanVerifier *hcertverifier.Verifier
+
+	// findDomesticVerifierPk is used to verify proofs that were disclosed with a disclosure profile
+	findDomesticVerifierPk idemixcommon.FindIssuerPkFunc
 )
 
 func InitializeVerifier(configDirectoryPath string) *Result {
@@ -98,24 +218,25 @@ func InitializeVerifier(configDirectoryPath string) *Result {
 		return WrappedErrorResult(err, "Could not read verifier config file")
 	}
 
-	err = json.Unmarshal(configJson, &verifierConfig)
+	// Unmarshal into a new config, so no values of a previously loaded config remain
+	var config *verifierConfiguration
+	err = json.Unmarshal(configJson, &config)
 	if err != nil {
 		return WrappedErrorResult(err, "Could not JSON unmarshal verifier config")
 	}
 
-	if verifierConfig.DomesticVerificationRules == nil {
+	if config == nil || config.DomesticVerificationRules == nil {
 		return ErrorResult(errors.Errorf("The domestic verification rules were not present"))
 	}
 
-	if verifierConfig.EuropeanVerificationRules == nil {
+	if config.EuropeanVerificationRules == nil {
 		return ErrorResult(errors.Errorf("The European verification rules were not present"))
 	}
 
-	// Parse date once (and leave at default value if parsing goes awry)
-	verifierConfig.EuropeanVerificationRules.vaccinationValidityIntoForceDate, _ = time.Parse(
-		YYYYMMDD_FORMAT,
-		verifierConfig.EuropeanVerificationRules.VaccinationValidityIntoForceDateStr,
-	)
+	err = config.EuropeanVerificationRules.prepare()
+	if err != nil {
+		return WrappedErrorResult(err, "Could not prepare European verification rules")
+	}
 
 	// Read public keys
 	publicKeysConfig, err := NewPublicKeysConfig(pksPath)
@@ -123,8 +244,10 @@ func InitializeVerifier(configDirectoryPath string) *Result {
 		return WrappedErrorResult(err, "Could not load public keys config")
 	}
 
-	// Initialize verifiers
+	// Only replace the config and verifiers when everything has loaded
+	verifierConfig = config
 	domesticVerifier = idemixverifier.New(publicKeysConfig.FindAndCacheDomestic)
+	findDomesticVerifierPk = publicKeysConfig.FindAndCacheDomestic
 	europeanVerifier = hcertverifier.New(publicKeysConfig.EuropeanPks)
 
 	return &Result{nil, ""}
@@ -138,7 +261,47 @@ func VerifyWithTime(proofQREncoded []byte, verificationPolicy string, unixTimeSe
 	return verify(proofQREncoded, verificationPolicy, time.Unix(unixTimeSeconds, 0))
 }
 
+// VerifyFullDetail verifies a European QR code like Verify, but also returns the full content of the
+//  DCC statement that it is valid by. It is meant for border control, and must be enabled in the config.
+func VerifyFullDetail(proofQREncoded []byte, verificationPolicy string) *VerificationResult {
+	return verifyFullDetail(proofQREncoded, verificationPolicy, time.Now())
+}
+
+func VerifyFullDetailWithTime(proofQREncoded []byte, verificationPolicy string, unixTimeSeconds int64) *VerificationResult {
+	return verifyFullDetail(proofQREncoded, verificationPolicy, time.Unix(unixTimeSeconds, 0))
+}
+
 func verify(proofQREncoded []byte, policy string, now time.Time) *VerificationResult {
+	return verifyWithMode(proofQREncoded, policy, now, false)
+}
+
+func verifyFullDetail(proofQREncoded []byte, policy string, now time.Time) *VerificationResult {
+	if verifierConfig == nil || verifierConfig.EuropeanVerificationRules == nil {
+		return &VerificationResult{
+			Status: VERIFICATION_FAILED_ERROR,
+			Error:  errors.Errorf("The verifier must be initialized before full-detail verification").Error(),
+		}
+	}
+
+	if !verifierConfig.EuropeanVerificationRules.FullDetailVerificationEnabled {
+		return &VerificationResult{
+			Status: VERIFICATION_FAILED_ERROR,
+			Error:  errors.Errorf("Full-detail verification is not enabled").Error(),
+		}
+	}
+
+	// Domestic QR codes only contain the minimal details
+	if idemixcommon.HasNLPrefix(proofQREncoded) {
+		return &VerificationResult{
+			Status: VERIFICATION_FAILED_ERROR,
+			Error:  errors.Errorf("Full-detail verification is only supported for European QR codes").Error(),
+		}
+	}
+
+	return verifyWithMode(proofQREncoded, policy, now, true)
+}
+
+func verifyWithMode(proofQREncoded []byte, policy string, now time.Time, fullDetail bool) *VerificationResult {
 	// Verification policy must be either 1G or 3G
 	if policy != VERIFICATION_POLICY_1G && policy != VERIFICATION_POLICY_3G {
 		return &VerificationResult{
@@ -147,16 +310,35 @@ func verify(proofQREncoded []byte, policy string, now time.Time) *VerificationRe
 		}
 	}
 
+	scanLockWarning, isLocked, err := checkAndLogScan(policy, now)
+	if isLocked {
+		return &VerificationResult{
+			Status: VERIFICATION_FAILED_SCAN_LOCKED,
+			Error:  err.Error(),
+		}
+	}
+
+	if err != nil {
+		return &VerificationResult{
+			Status: VERIFICATION_FAILED_ERROR,
+			Error:  err.Error(),
+		}
+	}
+
+	var result *VerificationResult
 	if idemixcommon.HasNLPrefix(proofQREncoded) {
-		return handleDomesticVerification(proofQREncoded, policy, now)
+		result = handleDomesticVerification(proofQREncoded, policy, now)
 	} else {
-		return handleEuropeanVerification(proofQREncoded, policy, now)
+		result = handleEuropeanVerification(proofQREncoded, policy, now, fullDetail)
 	}
+
+	result.ScanLockWarning = scanLockWarning
+	return result
 }
 
 func handleDomesticVerification(proofQREncoded []byte, policy string, now time.Time) *VerificationResult {
 	rules := verifierConfig.DomesticVerificationRules
-	verificationDetails, err := verifyDomestic(proofQREncoded, policy, rules, now)
+	verificationDetails, isReplayed, err := verifyDomestic(proofQREncoded, policy, rules, now)
 	if err != nil {
 		return &VerificationResult{
 			Status: VERIFICATION_FAILED_ERROR,
@@ -164,13 +346,20 @@ func handleDomesticVerification(proofQREncoded []byte, policy string, now time.T
 		}
 	}
 
+	if isReplayed {
+		return &VerificationResult{
+			Status: VERIFICATION_FAILED_REPLAYED,
+			Error:  errors.Errorf("The domestic QR code has already been presented recently").Error(),
+		}
+	}
+
 	return &VerificationResult{
 		Status:  VERIFICATION_SUCCESS,
 		Details: verificationDetails,
 	}
 }
 
-func handleEuropeanVerification(proofQREncoded []byte, policy string, now time.Time) *VerificationResult {
+func handleEuropeanVerification(proofQREncoded []byte, policy string, now time.Time, fullDetail bool) *VerificationResult {
 	// As some QR-codes by T-Systems apps miss the required prefix, add the prefix here if it isn't present
 	wasEUPrefixed := hcertcommon.HasEUPrefix(proofQREncoded)
 	if !wasEUPrefixed {
@@ -178,7 +367,7 @@ func handleEuropeanVerification(proofQREncoded []byte, policy string, now time.T
 	}
 
 	rules := verifierConfig.EuropeanVerificationRules
-	verificationDetails, isNLDCC, err := verifyEuropean(proofQREncoded, policy, rules, now)
+	verificationDetails, fullDetails, isNLDCC, err := verifyEuropean(proofQREncoded, policy, rules, now, fullDetail)
 	if err != nil {
 		// If the QR-code wasn't prefixed and it didn't verify, assume that it wasn't a EU QR code
 		if !wasEUPrefixed {
@@ -200,8 +389,9 @@ func handleEuropeanVerification(proofQREncoded []byte, policy string, now time.T
 	}
 
 	return &VerificationResult{
-		Status:  VERIFICATION_SUCCESS,
-		Details: verificationDetails,
+		Status:      VERIFICATION_SUCCESS,
+		Details:     verificationDetails,
+		FullDetails: fullDetails,
 	}
 }
 
@@ -0,0 +1,120 @@
+package mobilecore
+
+import (
+	"fmt"
+	"github.com/go-errors/errors"
+	"time"
+)
+
+// ageBracket changes the verification rules for holders within an age range, like exempting young children
+//  or using a different test validity for minors. The maximum age is exclusive, and zero means no maximum.
+type ageBracket struct {
+	MinimumAgeYears int `json:"minimumAgeYears"`
+	MaximumAgeYears int `json:"maximumAgeYears"`
+
+	// IsExempt accepts holders within the bracket without a valid statement
+	IsExempt bool `json:"isExempt"`
+
+	// AcceptedStatementTypes limits the statement types that are accepted, where empty accepts all types
+	AcceptedStatementTypes []string `json:"acceptedStatementTypes"`
+
+	// TestValidityHours overrides the test validity of the European rules for all test types when positive
+	TestValidityHours int `json:"testValidityHours"`
+}
+
+// findAgeBracket returns the first bracket the holder is certain to be in, or nil if there is none.
+//  For a partial date of birth, the holder must be within the bracket for every possible birth date,
+//  so an unknown month or day never places a holder in a bracket they may not belong to. Birthdays start
+//  at midnight in the given location.
+func findAgeBracket(brackets []*ageBracket, dob string, now time.Time, loc *time.Location) *ageBracket {
+	if len(brackets) == 0 {
+		return nil
+	}
+
+	youngestAge, oldestAge, err := ageRange(dob, now.In(loc))
+	if err != nil {
+		return nil
+	}
+
+	for _, bracket := range brackets {
+		if youngestAge < bracket.MinimumAgeYears {
+			continue
+		}
+
+		if bracket.MaximumAgeYears != 0 && oldestAge >= bracket.MaximumAgeYears {
+			continue
+		}
+
+		return bracket
+	}
+
+	return nil
+}
+
+// ageRange returns the youngest and oldest age in full years the holder can have with a (partial) date of birth,
+//  by the calendar day of now in its location. Without a year of birth the age is unknown, and an error is returned.
+func ageRange(dob string, now time.Time) (youngestAge, oldestAge int, err error) {
+	year, month, day, err := parseDateOfBirth(dob)
+	if err != nil {
+		return 0, 0, errors.WrapPrefix(err, "Could not parse date of birth", 0)
+	}
+
+	if year == "" {
+		return 0, 0, errors.Errorf("The year of birth is unknown")
+	}
+
+	// The most recent birth date gives the youngest age, and the earliest birth date the oldest
+	mostRecentDOB, err := mostRecentDOBDayMonth(dob, now.Location())
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if month == "" {
+		month = "01"
+	}
+
+	if day == "" {
+		day = "01"
+	}
+
+	earliestDOB, err := parseDateInLocation(fmt.Sprintf("%s-%s-%s", year, month, day), now.Location())
+	if err != nil {
+		return 0, 0, errors.WrapPrefix(err, "Could not parse earliest date of birth", 0)
+	}
+
+	return ageInYears(mostRecentDOB, now), ageInYears(earliestDOB, now), nil
+}
+
+func ageInYears(dob time.Time, now time.Time) int {
+	age := now.Year() - dob.Year()
+	if now.Month() < dob.Month() || (now.Month() == dob.Month() && now.Day() < dob.Day()) {
+		age--
+	}
+
+	return age
+}
+
+// applyTo returns a copy of the European rules with the overrides of the bracket applied
+func (bracket *ageBracket) applyTo(rules *europeanVerificationRules) *europeanVerificationRules {
+	bracketRules := *rules
+	if bracket.TestValidityHours > 0 {
+		bracketRules.TestValidityHours = bracket.TestValidityHours
+		bracketRules.TestValidityHoursPerType = nil
+	}
+
+	return &bracketRules
+}
+
+func (bracket *ageBracket) validateStatementType(statement *dccStatement) error {
+	if len(bracket.AcceptedStatementTypes) == 0 {
+		return nil
+	}
+
+	for _, statementType := range bracket.AcceptedStatementTypes {
+		if statementType == statement.statementType {
+			return nil
+		}
+	}
+
+	return errors.Errorf("A %s statement is not accepted for the age of the holder", statement.statementType)
+}
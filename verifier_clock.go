@@ -0,0 +1,98 @@
+package mobilecore
+
+import (
+	"encoding/json"
+	"github.com/go-errors/errors"
+	"sync"
+	"time"
+)
+
+type ClockDeviationResultValue struct {
+	DeviationSeconds int64 `json:"deviationSeconds"`
+	IsDeviating      bool  `json:"isDeviating"`
+}
+
+// trustedTime is a server time together with the monotonic clock reading at which it was received
+type trustedTime struct {
+	serverUnixTimeSeconds int64
+	monotonicMillis       int64
+}
+
+var (
+	trustedTimeMutex sync.Mutex
+	lastTrustedTime  *trustedTime
+)
+
+// SetTrustedServerTime records the time of a trusted server, together with a monotonic clock reading of
+//  the device (like the elapsed realtime or system uptime) at the moment the server response was received.
+//  The monotonic clock is not affected by the user changing the device clock.
+func SetTrustedServerTime(serverUnixTimeSeconds, monotonicMillis int64) {
+	trustedTimeMutex.Lock()
+	defer trustedTimeMutex.Unlock()
+
+	lastTrustedTime = &trustedTime{
+		serverUnixTimeSeconds: serverUnixTimeSeconds,
+		monotonicMillis:       monotonicMillis,
+	}
+}
+
+// GetClockDeviation returns the estimated deviation of the device clock from the trusted server time, using a
+//  current monotonic clock reading. The deviation is positive when the device clock runs ahead.
+func GetClockDeviation(monotonicMillis int64) *Result {
+	return getClockDeviation(monotonicMillis, time.Now())
+}
+
+// VerifyWithClockCorrection verifies at the estimated trusted server time instead of the device time,
+//  and falls back to the device time when no estimate is available
+func VerifyWithClockCorrection(proofQREncoded []byte, verificationPolicy string, monotonicMillis int64) *VerificationResult {
+	now, err := estimateTrustedTime(monotonicMillis)
+	if err != nil {
+		now = time.Now()
+	}
+
+	return verify(proofQREncoded, verificationPolicy, now)
+}
+
+func getClockDeviation(monotonicMillis int64, now time.Time) *Result {
+	if verifierConfig == nil {
+		return ErrorResult(errors.Errorf("The verifier must be initialized before getting the clock deviation"))
+	}
+
+	estimatedTime, err := estimateTrustedTime(monotonicMillis)
+	if err != nil {
+		return ErrorResult(err)
+	}
+
+	deviationSeconds := now.Unix() - estimatedTime.Unix()
+	absDeviationSeconds := deviationSeconds
+	if absDeviationSeconds < 0 {
+		absDeviationSeconds = -absDeviationSeconds
+	}
+
+	resultJson, err := json.Marshal(&ClockDeviationResultValue{
+		DeviationSeconds: deviationSeconds,
+		IsDeviating:      absDeviationSeconds > verifierConfig.ClockDeviationThresholdSeconds,
+	})
+	if err != nil {
+		return WrappedErrorResult(err, "Could not JSON marshal clock deviation")
+	}
+
+	return &Result{resultJson, ""}
+}
+
+func estimateTrustedTime(monotonicMillis int64) (time.Time, error) {
+	trustedTimeMutex.Lock()
+	defer trustedTimeMutex.Unlock()
+
+	if lastTrustedTime == nil {
+		return time.Time{}, errors.Errorf("No trusted server time has been set")
+	}
+
+	// The monotonic clock is reset when the device reboots
+	elapsedMillis := monotonicMillis - lastTrustedTime.monotonicMillis
+	if elapsedMillis < 0 {
+		return time.Time{}, errors.Errorf("The monotonic clock has been reset since the trusted server time was set")
+	}
+
+	return time.Unix(lastTrustedTime.serverUnixTimeSeconds, 0).Add(time.Duration(elapsedMillis) * time.Millisecond), nil
+}
@@ -2,6 +2,7 @@ package mobilecore
 
 import (
 	"github.com/go-errors/errors"
+	idemixverifier "github.com/minvws/nl-covid19-coronacheck-idemix/verifier"
 	"math"
 	"strconv"
 	"time"
@@ -11,32 +12,49 @@ const (
 	CATEGORY_ATTRIBUTE_1G = "1"
 )
 
-func verifyDomestic(proof []byte, policy string, rules *domesticVerificationRules, now time.Time) (verificationDetails *VerificationDetails, err error) {
-	verifiedCred, err := domesticVerifier.VerifyQREncoded(proof)
+func verifyDomestic(proof []byte, policy string, rules *domesticVerificationRules, now time.Time) (verificationDetails *VerificationDetails, isReplayed bool, err error) {
+	var verifiedCred *idemixverifier.VerifiedCredential
+	var disclosureProfile string
+	if isProfileProof(proof) {
+		verifiedCred, disclosureProfile, err = verifyProfileProofQREncoded(proof, findDomesticVerifierPk)
+	} else {
+		verifiedCred, err = domesticVerifier.VerifyQREncoded(proof)
+	}
+
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	err = checkDenylist(verifiedCred.ProofIdentifier, rules.ProofIdentifierDenylist)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	attributes := verifiedCred.Attributes
-	err = checkValidity(attributes["validFrom"], attributes["validForHours"], now)
+	validFrom, validUntil, err := checkValidity(attributes["validFrom"], attributes["validForHours"], now)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	isPaperProof := attributes["isPaperProof"]
 	err = checkFreshness(verifiedCred.DisclosureTimeSeconds, isPaperProof, rules, now)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	err = checkPolicy(policy, verifiedCred.Attributes)
 	if err != nil {
-		return nil, err
+		return nil, false, err
+	}
+
+	err = checkRequiredAttributes(policy, verifiedCred.Attributes, rules)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Only valid proofs are remembered, and paper proofs are meant to be scanned repeatedly
+	if isPaperProof != PAPER_PROOF_ATTRIBUTE_VALUE && checkReplay(verifiedCred.ProofIdentifier, verifiedCred.DisclosureTimeSeconds, now) {
+		return nil, true, nil
 	}
 
 	// Build details
@@ -49,38 +67,67 @@ func verifyDomestic(proof []byte, policy string, rules *domesticVerificationRule
 		LastNameInitial:  attributes["lastNameInitial"],
 		BirthDay:         attributes["birthDay"],
 		BirthMonth:       attributes["birthMonth"],
+
+		DisclosureProfile: disclosureProfile,
 	}
 
-	return verificationDetails, nil
+	verificationDetails.ValidFrom, verificationDetails.ValidUntil = formatValidity(validFrom, validUntil)
+
+	return verificationDetails, false, nil
 }
 
-func checkValidity(validFromStr string, validForHoursStr string, now time.Time) error {
-	validFrom, err := strconv.ParseInt(validFromStr, 10, 64)
+func checkValidity(validFromStr string, validForHoursStr string, now time.Time) (validFrom, validUntil time.Time, err error) {
+	validFrom, validUntil, err = domesticValidity(validFromStr, validForHoursStr)
 	if err != nil {
-		return errors.WrapPrefix(err, "Could not parse validFrom as int", 0)
+		return time.Time{}, time.Time{}, err
 	}
 
-	validForHours, err := strconv.ParseInt(validForHoursStr, 10, 0)
-	if err != nil {
-		return errors.WrapPrefix(err, "Could not parse validForHours as int", 0)
+	unixTimeNow := now.UTC().Unix()
+	if unixTimeNow < validFrom.Unix() {
+		return time.Time{}, time.Time{}, errors.Errorf("The credential is not yet valid")
 	}
 
-	unixTimeNow := now.UTC().Unix()
-	if unixTimeNow < validFrom {
-		return errors.Errorf("The credential is not yet valid")
+	if unixTimeNow >= validUntil.Unix() {
+		return time.Time{}, time.Time{}, errors.Errorf("The credential is not valid anymore")
 	}
 
-	validUntil := validFrom + validForHours*60*60
-	if unixTimeNow >= validUntil {
-		return errors.Errorf("The credential is not valid anymore")
+	return validFrom, validUntil, nil
+}
+
+// formatValidity formats the validity period for the verification details, where the zero time is unknown
+//  for valid from, and indefinite for valid until
+func formatValidity(validFrom, validUntil time.Time) (validFromStr, validUntilStr string) {
+	if !validFrom.IsZero() {
+		validFromStr = strconv.FormatInt(validFrom.Unix(), 10)
 	}
 
-	return nil
+	validUntilStr = VALIDITY_INDEFINITE
+	if !validUntil.IsZero() {
+		validUntilStr = strconv.FormatInt(validUntil.Unix(), 10)
+	}
+
+	return validFromStr, validUntilStr
+}
+
+// domesticValidity returns the validity period of a domestic credential, where validUntil is exclusive
+func domesticValidity(validFromStr string, validForHoursStr string) (validFrom, validUntil time.Time, err error) {
+	validFromUnix, err := strconv.ParseInt(validFromStr, 10, 64)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.WrapPrefix(err, "Could not parse validFrom as int", 0)
+	}
+
+	validForHours, err := strconv.ParseInt(validForHoursStr, 10, 0)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.WrapPrefix(err, "Could not parse validForHours as int", 0)
+	}
+
+	validUntilUnix := validFromUnix + validForHours*60*60
+	return time.Unix(validFromUnix, 0), time.Unix(validUntilUnix, 0), nil
 }
 
 func checkFreshness(generatedAtTimestamp int64, isPaperProofStr string, rules *domesticVerificationRules, now time.Time) error {
 	// Paper proof are exempt from this check
-	if isPaperProofStr == "1" {
+	if isPaperProofStr == PAPER_PROOF_ATTRIBUTE_VALUE {
 		return nil
 	}
 
@@ -112,3 +159,18 @@ func checkPolicy(policy string, attributes map[string]string) error {
 
 	return nil
 }
+
+func checkRequiredAttributes(policy string, attributes map[string]string, rules *domesticVerificationRules) error {
+	requiredAttributes, ok := rules.PolicyRequiredAttributes[policy]
+	if !ok {
+		requiredAttributes = identityAttributes
+	}
+
+	for _, attributeType := range requiredAttributes {
+		if _, ok := attributes[attributeType]; !ok {
+			return errors.Errorf("The credential did not disclose the %s attribute that is required by the verification policy", attributeType)
+		}
+	}
+
+	return nil
+}
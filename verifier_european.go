@@ -5,6 +5,7 @@ import (
 	hcertcommon "github.com/minvws/nl-covid19-coronacheck-hcert/common"
 	"github.com/minvws/nl-covid19-coronacheck-hcert/verifier"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -14,57 +15,89 @@ const (
 	DISEASE_TARGETED_COVID_19               = "840539006"
 	TEST_RESULT_NOT_DETECTED                = "260415000"
 	VACCINE_MEDICINAL_PRODUCT_JANSSEN       = "EU/1/20/1525"
+	TEST_TYPE_NAAT                          = "LP6464-4"
+	TEST_TYPE_RAT                           = "LP217198-3"
 
 	YYYYMMDD_FORMAT = "2006-01-02"
 	DOB_EMPTY_VALUE = "XX"
 )
 
+const (
+	DOSE_CLASSIFICATION_PRIMARY_INCOMPLETE = "primaryIncomplete"
+	DOSE_CLASSIFICATION_PRIMARY_COMPLETE   = "primaryComplete"
+	DOSE_CLASSIFICATION_BOOSTER            = "booster"
+	DOSE_CLASSIFICATION_ADDITIONAL         = "additional"
+)
+
 var (
 	DATE_OF_BIRTH_REGEX = regexp.MustCompile(`^(?:((?:19|20)\d\d)(?:-(\d\d)(?:-(\d\d))?)?)?$`)
 )
 
-func verifyEuropean(proofQREncoded []byte, policy string, rules *europeanVerificationRules, now time.Time) (details *VerificationDetails, isNLDCC bool, err error) {
+// verifyEuropean only returns the full details when requested, as the default verification is privacy-minimal
+func verifyEuropean(proofQREncoded []byte, policy string, rules *europeanVerificationRules, now time.Time, fullDetail bool) (details *VerificationDetails, fullDetails *FullVerificationDetails, isNLDCC bool, err error) {
 	// Validate signature and get health certificate
 	verified, err := europeanVerifier.VerifyQREncoded(proofQREncoded)
 	if err != nil {
-		return nil, false, err
+		return nil, nil, false, err
 	}
 
+	details, statement, isNLDCC, err := validateVerifiedEuropean(verified, policy, rules, now)
+	if err != nil || isNLDCC {
+		return nil, nil, isNLDCC, err
+	}
+
+	if fullDetail {
+		fullDetails = buildFullVerificationDetails(verified.HealthCertificate, statement)
+	}
+
+	return details, fullDetails, false, nil
+}
+
+func validateVerifiedEuropean(verified *verifier.VerifiedHCert, policy string, rules *europeanVerificationRules, now time.Time) (details *VerificationDetails, statement *dccStatement, isNLDCC bool, err error) {
 	hcert := verified.HealthCertificate
 	pk := verified.PublicKey
 
 	// Check denylist
 	err = checkDenylist(verified.ProofIdentifier, rules.ProofIdentifierDenylist)
 	if err != nil {
-		return nil, false, err
+		return nil, nil, false, err
 	}
 
 	// Exit early if it's an NL-issued CWT, so domestic credentials must be used instead
-	// As the constituent countries don't have domestic credentials, check if the subject alternative name
-	//  of the public key is present and NLD. In that case European credentials are allowed.
-	if hcert.Issuer == "NL" && (len(pk.SubjectAltName) != 3 || pk.SubjectAltName == "NLD") {
-		return nil, true, nil
+	if isNLIssuedDCC(hcert, pk) {
+		return nil, nil, true, nil
 	}
 
 	// Validate health certificate metadata, and see if it's a specimen certificate
 	isSpecimen, err := validateHcert(hcert, now)
 	if err != nil {
-		return nil, false, errors.WrapPrefix(err, "Could not validate health certificate", 0)
+		return nil, nil, false, errors.WrapPrefix(err, "Could not validate health certificate", 0)
 	}
 
 	// Validate DCC
-	err = validateDCC(hcert.DCC, policy, rules, now)
+	statement, validFrom, validUntil, err := validateDCCWithStatement(hcert.DCC, policy, rules, now)
 	if err != nil {
-		return nil, false, errors.WrapPrefix(err, "Could not validate DCC", 0)
+		return nil, nil, false, errors.WrapPrefix(err, "Could not validate DCC", 0)
 	}
 
 	// Build the resulting details
 	result, err := buildVerificationDetails(hcert, pk, rules, isSpecimen)
 	if err != nil {
-		return nil, false, err
+		return nil, nil, false, err
+	}
+
+	if len(dccStatements(hcert.DCC)) > 1 {
+		result.UsedStatement = statement.String()
 	}
 
-	return result, false, nil
+	if statement.statementType == DCC_STATEMENT_VACCINATION {
+		result.DoseClassification = classifyDose(statement.vaccination)
+	}
+
+	validFrom, validUntil = boundByHcertValidity(hcert, validFrom, validUntil)
+	result.ValidFrom, result.ValidUntil = formatValidity(validFrom, validUntil)
+
+	return result, statement, false, nil
 }
 
 func validateHcert(hcert *hcertcommon.HealthCertificate, now time.Time) (isSpecimen bool, err error) {
@@ -93,47 +126,89 @@ func validateHcert(hcert *hcertcommon.HealthCertificate, now time.Time) (isSpeci
 }
 
 func validateDCC(dcc *hcertcommon.DCC, policy string, rules *europeanVerificationRules, now time.Time) (err error) {
+	_, _, _, err = validateDCCWithStatement(dcc, policy, rules, now)
+	return err
+}
+
+// validateDCCWithStatement validates the DCC, and returns the statement it is valid by together with the period
+//  in which it is valid. The period ends at the zero time when the holder is exempt from having a valid statement.
+func validateDCCWithStatement(dcc *hcertcommon.DCC, policy string, rules *europeanVerificationRules, now time.Time) (statement *dccStatement, validFrom, validUntil time.Time, err error) {
 	// Validate date of birth
 	err = validateDateOfBirth(dcc.DateOfBirth)
 	if err != nil {
-		return errors.WrapPrefix(err, "Invalid date of birth", 0)
+		return nil, time.Time{}, time.Time{}, errors.WrapPrefix(err, "Invalid date of birth", 0)
 	}
 
 	// Validate name
 	err = validateName(dcc.Name)
 	if err != nil {
-		return errors.WrapPrefix(err, "Invalid name", 0)
+		return nil, time.Time{}, time.Time{}, errors.WrapPrefix(err, "Invalid name", 0)
 	}
 
 	// Validate statement amount
-	err = validateStatementAmount(dcc)
+	err = validateStatementAmount(dcc, rules)
 	if err != nil {
-		return errors.WrapPrefix(err, "Invalid statement amount", 0)
+		return nil, time.Time{}, time.Time{}, errors.WrapPrefix(err, "Invalid statement amount", 0)
+	}
+
+	// The age of the holder may change which statements are accepted and how long they are valid
+	bracket := findAgeBracket(rules.AgeBrackets, dcc.DateOfBirth, now, rules.location())
+	if bracket != nil {
+		rules = bracket.applyTo(rules)
 	}
 
 	// Validate statements
-	for _, vacc := range dcc.Vaccinations {
-		err = validateVaccination(vacc, dcc.DateOfBirth, policy, rules, now)
-		if err != nil {
-			return errors.WrapPrefix(err, "Invalid vaccination statement", 0)
+	statements := dccStatements(dcc)
+	var validStatements []*dccStatement
+	var firstErr error
+	for _, statement := range statements {
+		err = statement.validate(dcc.DateOfBirth, policy, rules, now)
+		if err == nil && bracket != nil {
+			err = bracket.validateStatementType(statement)
 		}
-	}
 
-	for _, test := range dcc.Tests {
-		err = validateTest(test, rules, now)
 		if err != nil {
-			return errors.WrapPrefix(err, "Invalid test statement", 0)
+			if firstErr == nil {
+				firstErr = err
+			}
+
+			continue
 		}
+
+		validStatements = append(validStatements, statement)
 	}
 
-	for _, rec := range dcc.Recoveries {
-		err = validateRecovery(rec, policy, rules, now)
-		if err != nil {
-			return errors.WrapPrefix(err, "Invalid recovery statement", 0)
-		}
+	// Exempt holders don't need a valid statement, so the first statement is used for the details if none is valid
+	isExempt := bracket != nil && bracket.IsExempt
+	if isExempt && len(validStatements) == 0 {
+		return statements[0], time.Time{}, time.Time{}, nil
 	}
 
-	return nil
+	// With multiple statements, either all or at least one must be valid
+	if !isExempt && firstErr != nil && (rules.MultipleStatementsMode != MULTIPLE_STATEMENTS_MOST_FAVORABLE || len(validStatements) == 0) {
+		return nil, time.Time{}, time.Time{}, firstErr
+	}
+
+	statement, err = mostFavorableStatement(validStatements, dcc.DateOfBirth, rules)
+	if err != nil {
+		return nil, time.Time{}, time.Time{}, err
+	}
+
+	if isExempt {
+		return statement, time.Time{}, time.Time{}, nil
+	}
+
+	validityStatements := []*dccStatement{statement}
+	if rules.MultipleStatementsMode == MULTIPLE_STATEMENTS_ALL_VALID {
+		validityStatements = validStatements
+	}
+
+	validFrom, validUntil, err = statementsValidity(validityStatements, dcc.DateOfBirth, rules)
+	if err != nil {
+		return nil, time.Time{}, time.Time{}, err
+	}
+
+	return statement, validFrom, validUntil, nil
 }
 
 func validateDateOfBirth(dob string) error {
@@ -153,7 +228,7 @@ func validateName(name *hcertcommon.DCCName) error {
 	return nil
 }
 
-func validateStatementAmount(dcc *hcertcommon.DCC) error {
+func validateStatementAmount(dcc *hcertcommon.DCC, rules *europeanVerificationRules) error {
 	vaccAmount := len(dcc.Vaccinations)
 	testAmount := len(dcc.Tests)
 	recAmount := len(dcc.Recoveries)
@@ -163,14 +238,21 @@ func validateStatementAmount(dcc *hcertcommon.DCC) error {
 		return errors.Errorf("Contains no vaccination, test or recovery statements")
 	}
 
-	if totalAmount > 1 {
+	if totalAmount == 1 {
+		return nil
+	}
+
+	switch rules.MultipleStatementsMode {
+	case MULTIPLE_STATEMENTS_MOST_FAVORABLE, MULTIPLE_STATEMENTS_ALL_VALID:
+		return nil
+	case "", MULTIPLE_STATEMENTS_REJECT:
 		return errors.Errorf(
 			"Contains too many statements (%d vaccinations, %d tests and %d recoveries)",
 			vaccAmount, testAmount, recAmount,
 		)
+	default:
+		return errors.Errorf("Unrecognized multiple statements mode")
 	}
-
-	return nil
 }
 
 func validateVaccination(vacc *hcertcommon.DCCVaccination, dob string, policy string, rules *europeanVerificationRules, now time.Time) error {
@@ -194,52 +276,83 @@ func validateVaccination(vacc *hcertcommon.DCCVaccination, dob string, policy st
 		return errors.Errorf("Dose number is smaller than the specified total amount of doses")
 	}
 
-	// Date of vaccination with a configured delay in validity, with a special case for Janssen and boosters
-	dov, err := parseDate(vacc.DateOfVaccination)
+	// Date of vaccination with a configured delay in validity, with a special case for Janssen and boosters,
+	//  and the end of the vaccination validity period
+	validFrom, validUntil, err := vaccinationValidity(vacc, dob, rules)
 	if err != nil {
-		return errors.Errorf("Date of vaccination could not be parsed")
+		return err
 	}
 
-	// Determine waiting days depending on vaccine type and dose number
+	if now.Before(validFrom) {
+		return errors.Errorf("Date of vaccination is before the delayed validity date")
+	}
+
+	if validUntil.Before(now) {
+		return errors.Errorf("Date of vaccination is beyond the primary cycle validity period")
+	}
+
+	return nil
+}
+
+func vaccinationValidity(vacc *hcertcommon.DCCVaccination, dob string, rules *europeanVerificationRules) (validFrom, validUntil time.Time, err error) {
+	dov, err := parseDateInLocation(vacc.DateOfVaccination, rules.location())
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.Errorf("Date of vaccination could not be parsed")
+	}
+
+	// Determine waiting days depending on vaccine type, where boosters and additional doses are valid immediately
 	validityDelayDays := rules.VaccinationValidityDelayDays
 	if trimmedStringEquals(vacc.MedicinalProduct, VACCINE_MEDICINAL_PRODUCT_JANSSEN) {
 		validityDelayDays = rules.VaccinationJanssenValidityDelayDays
-		if vacc.DoseNumber > 1 {
-			validityDelayDays = 0
-		}
-	} else {
-		if vacc.DoseNumber > 2 {
-			validityDelayDays = 0
-		}
 	}
 
-	// Check if the dosenumber and the total amount of doses explicitly denote a booster
-	if vacc.DoseNumber > vacc.TotalSeriesOfDoses {
+	doseClassification := classifyDose(vacc)
+	if doseClassification == DOSE_CLASSIFICATION_BOOSTER || doseClassification == DOSE_CLASSIFICATION_ADDITIONAL {
 		validityDelayDays = 0
 	}
 
-	// Apply waiting days and check if the vaccination validity period has started
-	validFrom := dov.Add(time.Duration(validityDelayDays*24) * time.Hour)
-	if now.Before(validFrom) {
-		return errors.Errorf("Date of vaccination is before the delayed validity date")
-	}
+	// Apply waiting days to determine when the vaccination validity period starts
+	validFrom = dov.AddDate(0, 0, validityDelayDays)
 
-	// From the into force date from a minimum age (typically adults),
-	//  check if the vaccination validity has not yet ended
-	dobTime, err := mostRecentDOBDayMonth(dob)
+	// From the into force date from a minimum age (typically adults), the vaccination validity ends
+	//  after the configured amount of days. So it ends at the latest of those three moments.
+	dobTime, err := mostRecentDOBDayMonth(dob, rules.location())
 	if err != nil {
-		return errors.WrapPrefix(err, "Could not determine most recent date of birth day/month", 0)
+		return time.Time{}, time.Time{}, errors.WrapPrefix(err, "Could not determine most recent date of birth day/month", 0)
 	}
 
-	isAdult := dobTime.AddDate(rules.VaccinationMinimumAgeForValidityYears, 0, 0).Before(now)
-	if rules.vaccinationValidityIntoForceDate.Before(now) && isAdult {
-		validUntil := dov.Add(time.Duration(rules.VaccinationValidityDays*24) * time.Hour)
-		if validUntil.Before(now) {
-			return errors.Errorf("Date of vaccination is beyond the primary cycle validity period")
-		}
+	adultTime := dobTime.AddDate(rules.VaccinationMinimumAgeForValidityYears, 0, 0)
+	validUntil = dov.AddDate(0, 0, rules.VaccinationValidityDays)
+	validUntil = latestTime(validUntil, rules.vaccinationValidityIntoForceDate, adultTime)
+
+	return validFrom, validUntil, nil
+}
+
+// classifyDose determines if the vaccination completes the primary series or goes beyond it. A booster is the first
+//  dose after the primary series, which is either explicitly denoted by a dose number above the total series,
+//  or implicitly by a second Janssen dose or a third dose of another vaccine. Any later dose is an additional dose.
+func classifyDose(vacc *hcertcommon.DCCVaccination) string {
+	if vacc.DoseNumber < vacc.TotalSeriesOfDoses {
+		return DOSE_CLASSIFICATION_PRIMARY_INCOMPLETE
 	}
 
-	return nil
+	boosterDoseNumber := 3
+	if trimmedStringEquals(vacc.MedicinalProduct, VACCINE_MEDICINAL_PRODUCT_JANSSEN) {
+		boosterDoseNumber = 2
+	} else if vacc.TotalSeriesOfDoses+1 < boosterDoseNumber {
+		boosterDoseNumber = vacc.TotalSeriesOfDoses + 1
+	}
+
+	// The total series of doses may also be set to the booster dose number, like 3/3
+	if vacc.DoseNumber <= vacc.TotalSeriesOfDoses && vacc.DoseNumber < boosterDoseNumber {
+		return DOSE_CLASSIFICATION_PRIMARY_COMPLETE
+	}
+
+	if vacc.DoseNumber == boosterDoseNumber {
+		return DOSE_CLASSIFICATION_BOOSTER
+	}
+
+	return DOSE_CLASSIFICATION_ADDITIONAL
 }
 
 func validateTest(test *hcertcommon.DCCTest, rules *europeanVerificationRules, now time.Time) error {
@@ -249,28 +362,30 @@ func validateTest(test *hcertcommon.DCCTest, rules *europeanVerificationRules, n
 	}
 
 	// Test type
-	// The current business rules don't specify that we check for specific ma values
 	if !containsTrimmedString(rules.TestAllowedTypes, test.TypeOfTest) {
 		return errors.Errorf("Type is not allowed")
 	}
 
+	// Device of rapid tests, if an allowlist has been configured
+	if trimmedStringEquals(test.TypeOfTest, TEST_TYPE_RAT) && len(rules.RapidTestAllowedManufacturers) > 0 {
+		if !containsTrimmedString(rules.RapidTestAllowedManufacturers, test.TestNameAndManufacturer) {
+			return errors.Errorf("Rapid test device is not allowed")
+		}
+	}
+
 	// Test result
 	if !trimmedStringEquals(test.TestResult, TEST_RESULT_NOT_DETECTED) {
 		return errors.Errorf("Result should be negative (not detected)")
 	}
 
 	// Test time of collection
-	doc, err := time.Parse(time.RFC3339, test.DateTimeOfCollection)
+	doc, testExpirationTime, err := testValidity(test, rules)
 	if err != nil {
-		return errors.Errorf("Time of collection could not be parsed")
+		return err
 	}
 
-	testValidityHours := rules.TestValidityHours
-	testValidityDuration := time.Duration(testValidityHours) * time.Hour
-
-	testExpirationTime := doc.Add(testValidityDuration)
 	if testExpirationTime.Before(now) {
-		return errors.Errorf("Time of collection is more than %s ago", testValidityDuration.String())
+		return errors.Errorf("Time of collection is more than %s ago", testExpirationTime.Sub(doc).String())
 	}
 
 	if now.Before(doc) {
@@ -280,6 +395,24 @@ func validateTest(test *hcertcommon.DCCTest, rules *europeanVerificationRules, n
 	return nil
 }
 
+func testValidity(test *hcertcommon.DCCTest, rules *europeanVerificationRules) (validFrom, validUntil time.Time, err error) {
+	doc, err := time.Parse(time.RFC3339, test.DateTimeOfCollection)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.Errorf("Time of collection could not be parsed")
+	}
+
+	testValidityHours := rules.TestValidityHours
+	for testType, typeValidityHours := range rules.TestValidityHoursPerType {
+		if trimmedStringEquals(test.TypeOfTest, testType) {
+			testValidityHours = typeValidityHours
+		}
+	}
+
+	testValidityDuration := time.Duration(testValidityHours) * time.Hour
+
+	return doc, doc.Add(testValidityDuration), nil
+}
+
 func validateRecovery(rec *hcertcommon.DCCRecovery, policy string, rules *europeanVerificationRules, now time.Time) error {
 	// 1G policy doesn't allow vaccinations
 	if policy == VERIFICATION_POLICY_1G {
@@ -291,9 +424,31 @@ func validateRecovery(rec *hcertcommon.DCCRecovery, policy string, rules *europe
 		return errors.Errorf("Disease targeted should be COVID-19")
 	}
 
-	testDate, err := parseDate(rec.DateOfFirstPositiveTest)
+	validFrom, validUntil, err := recoveryValidity(rec, rules)
+	if err != nil {
+		return err
+	}
+
+	// Actually validate
+	if validUntil.Before(validFrom) {
+		return errors.Errorf("Valid until cannot be before valid from")
+	}
+
+	if now.Before(validFrom) {
+		return errors.Errorf("Recovery is not yet valid")
+	}
+
+	if validUntil.Before(now) {
+		return errors.Errorf("Recovery is not valid anymore")
+	}
+
+	return nil
+}
+
+func recoveryValidity(rec *hcertcommon.DCCRecovery, rules *europeanVerificationRules) (validFrom, validUntil time.Time, err error) {
+	testDate, err := parseDateInLocation(rec.DateOfFirstPositiveTest, rules.location())
 	if err != nil {
-		return errors.Errorf("Date of first positive test could not be parsed")
+		return time.Time{}, time.Time{}, errors.Errorf("Date of first positive test could not be parsed")
 	}
 
 	// Validity
@@ -301,34 +456,84 @@ func validateRecovery(rec *hcertcommon.DCCRecovery, policy string, rules *europe
 	validFromDays := rules.RecoveryValidFromDays
 	validUntilDays := rules.RecoveryValidUntilDays
 
-	validFrom := testDate.Add(time.Duration(validFromDays*24) * time.Hour)
-	validUntil := testDate.Add(time.Duration(validUntilDays*24) * time.Hour)
+	validFrom = testDate.AddDate(0, 0, validFromDays)
+	validUntil = testDate.AddDate(0, 0, validUntilDays)
 
 	// If the specified validity is smaller on any side, use that specified validity
-	specifiedValidFrom, err := parseDate(rec.CertificateValidFrom)
+	specifiedValidFrom, err := parseDateInLocation(rec.CertificateValidFrom, rules.location())
 	if err == nil && specifiedValidFrom.After(validFrom) {
 		validFrom = specifiedValidFrom
 	}
 
-	specifiedValidUntil, err := parseDate(rec.CertificateValidUntil)
+	specifiedValidUntil, err := parseDateInLocation(rec.CertificateValidUntil, rules.location())
 	if err == nil && specifiedValidUntil.Before(validUntil) {
 		validUntil = specifiedValidUntil
 	}
 
-	// Actually validate
-	if validUntil.Before(validFrom) {
-		return errors.Errorf("Valid until cannot be before valid from")
+	return validFrom, validUntil, nil
+}
+
+// dccValidity returns the validity period of the statement in the DCC, bounded by the validity of the
+//  CWT itself (unless it's a specimen). When multiple statements are accepted, the statement that is valid
+//  the longest is used, and when all statements must be valid the validity periods are intersected.
+func dccValidity(hcert *hcertcommon.HealthCertificate, rules *europeanVerificationRules) (validFrom, validUntil time.Time, err error) {
+	dcc := hcert.DCC
+	err = validateStatementAmount(dcc, rules)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
 	}
 
-	if now.Before(validFrom) {
-		return errors.Errorf("Recovery is not yet valid")
+	statements := dccStatements(dcc)
+	if rules.MultipleStatementsMode != MULTIPLE_STATEMENTS_ALL_VALID {
+		statement, err := mostFavorableStatement(statements, dcc.DateOfBirth, rules)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+
+		statements = []*dccStatement{statement}
 	}
 
-	if validUntil.Before(now) {
-		return errors.Errorf("Recovery is not valid anymore")
+	validFrom, validUntil, err = statementsValidity(statements, dcc.DateOfBirth, rules)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
 	}
 
-	return nil
+	validFrom, validUntil = boundByHcertValidity(hcert, validFrom, validUntil)
+	return validFrom, validUntil, nil
+}
+
+// statementsValidity returns the period in which all of the given statements are valid
+func statementsValidity(statements []*dccStatement, dob string, rules *europeanVerificationRules) (validFrom, validUntil time.Time, err error) {
+	for i, statement := range statements {
+		statementValidFrom, statementValidUntil, err := statement.validity(dob, rules)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+
+		if i == 0 {
+			validFrom, validUntil = statementValidFrom, statementValidUntil
+		} else {
+			validFrom = latestTime(validFrom, statementValidFrom)
+			validUntil = earliestTime(validUntil, statementValidUntil)
+		}
+	}
+
+	return validFrom, validUntil, nil
+}
+
+// boundByHcertValidity bounds the validity period by the validity of the CWT itself, unless it's a specimen.
+//  A zero validUntil denotes an indefinite validity, which then ends with the CWT.
+func boundByHcertValidity(hcert *hcertcommon.HealthCertificate, validFrom, validUntil time.Time) (time.Time, time.Time) {
+	if hcert.ExpirationTime == HCERT_SPECIMEN_EXPIRATION_TIME {
+		return validFrom, validUntil
+	}
+
+	expirationTime := time.Unix(hcert.ExpirationTime, 0)
+	if validUntil.IsZero() {
+		validUntil = expirationTime
+	}
+
+	return latestTime(validFrom, time.Unix(hcert.IssuedAt, 0)), earliestTime(validUntil, expirationTime)
 }
 
 func buildVerificationDetails(hcert *hcertcommon.HealthCertificate, pk *verifier.AnnotatedEuropeanPk, rules *europeanVerificationRules, isSpecimen bool) (*VerificationDetails, error) {
@@ -363,10 +568,73 @@ func buildVerificationDetails(hcert *hcertcommon.HealthCertificate, pk *verifier
 		familyNameInitial = hcert.DCC.Name.StandardizedFamilyName[0:1]
 	}
 
+	issCountryCode := determineIssuerCountryCode(hcert, pk, rules)
+
+	return &VerificationDetails{
+		CredentialVersion: "1",
+		IsSpecimen:        isSpecimenStr,
+		IssuerCountryCode: issCountryCode,
+
+		BirthMonth:       birthMonth,
+		BirthDay:         birthDay,
+		FirstNameInitial: firstNameInitial,
+		LastNameInitial:  familyNameInitial,
+	}, nil
+}
+
+func buildFullVerificationDetails(hcert *hcertcommon.HealthCertificate, statement *dccStatement) *FullVerificationDetails {
+	dcc := hcert.DCC
+	fullDetails := &FullVerificationDetails{
+		FamilyName:             dcc.Name.FamilyName,
+		StandardizedFamilyName: dcc.Name.StandardizedFamilyName,
+		GivenName:              dcc.Name.GivenName,
+		StandardizedGivenName:  dcc.Name.StandardizedGivenName,
+		DateOfBirth:            dcc.DateOfBirth,
+		StatementType:          statement.statementType,
+	}
+
+	switch statement.statementType {
+	case DCC_STATEMENT_VACCINATION:
+		vacc := statement.vaccination
+		fullDetails.CountryOfStatement = vacc.CountryOfVaccination
+		fullDetails.CertificateIssuer = vacc.CertificateIssuer
+		fullDetails.MedicinalProduct = vacc.MedicinalProduct
+		fullDetails.Manufacturer = vacc.Manufacturer
+		fullDetails.DoseNumber = strconv.Itoa(vacc.DoseNumber)
+		fullDetails.TotalSeriesOfDoses = strconv.Itoa(vacc.TotalSeriesOfDoses)
+		fullDetails.DateOfVaccination = vacc.DateOfVaccination
+	case DCC_STATEMENT_TEST:
+		test := statement.test
+		fullDetails.CountryOfStatement = test.CountryOfVaccination
+		fullDetails.CertificateIssuer = test.CertificateIssuer
+		fullDetails.TypeOfTest = test.TypeOfTest
+		fullDetails.TestName = test.TestName
+		fullDetails.TestNameAndManufacturer = test.TestNameAndManufacturer
+		fullDetails.DateTimeOfCollection = test.DateTimeOfCollection
+	default:
+		rec := statement.recovery
+		fullDetails.CountryOfStatement = rec.CountryOfTest
+		fullDetails.CertificateIssuer = rec.CertificateIssuer
+		fullDetails.DateOfFirstPositiveTest = rec.DateOfFirstPositiveTest
+		fullDetails.CertificateValidFrom = rec.CertificateValidFrom
+		fullDetails.CertificateValidUntil = rec.CertificateValidUntil
+	}
+
+	return fullDetails
+}
+
+// As the constituent countries don't have domestic credentials, an NL-issued CWT is only considered
+//  to be an NL DCC if the subject alternative name of the public key is absent or NLD
+func isNLIssuedDCC(hcert *hcertcommon.HealthCertificate, pk *verifier.AnnotatedEuropeanPk) bool {
+	return hcert.Issuer == DCC_DOMESTIC_ISSUER_COUNTRY_CODE &&
+		(len(pk.SubjectAltName) != 3 || pk.SubjectAltName == DCC_DOMESTIC_ISSUER_KEY_SAN)
+}
+
+func determineIssuerCountryCode(hcert *hcertcommon.HealthCertificate, pk *verifier.AnnotatedEuropeanPk, rules *europeanVerificationRules) string {
 	// Add the issuing country according to the hcert issuer field
 	// For the NL-issuer, determine the two-letter country code from the public key SAN
 	issCountryCode := hcert.Issuer
-	if issCountryCode == "NL" {
+	if issCountryCode == DCC_DOMESTIC_ISSUER_COUNTRY_CODE {
 		pkCountryCode, ok := rules.IssuerCountryCodeFromCASIslandSAN[pk.SubjectAltName]
 		if ok {
 			issCountryCode = pkCountryCode
@@ -379,16 +647,7 @@ func buildVerificationDetails(hcert *hcertcommon.HealthCertificate, pk *verifier
 		issCountryCode = correctedCountryCode
 	}
 
-	return &VerificationDetails{
-		CredentialVersion: "1",
-		IsSpecimen:        isSpecimenStr,
-		IssuerCountryCode: issCountryCode,
-
-		BirthMonth:       birthMonth,
-		BirthDay:         birthDay,
-		FirstNameInitial: firstNameInitial,
-		LastNameInitial:  familyNameInitial,
-	}, nil
+	return issCountryCode
 }
 
 // To handle the special case of BG/GR including spaces in certain values,
@@ -0,0 +1,108 @@
+package mobilecore
+
+import (
+	"fmt"
+	"github.com/go-errors/errors"
+	hcertcommon "github.com/minvws/nl-covid19-coronacheck-hcert/common"
+	"time"
+)
+
+const (
+	MULTIPLE_STATEMENTS_REJECT         = "reject"
+	MULTIPLE_STATEMENTS_MOST_FAVORABLE = "mostFavorable"
+	MULTIPLE_STATEMENTS_ALL_VALID      = "allValid"
+)
+
+const (
+	DCC_STATEMENT_VACCINATION = "vaccination"
+	DCC_STATEMENT_TEST        = "test"
+	DCC_STATEMENT_RECOVERY    = "recovery"
+)
+
+// dccStatement is a single vaccination, test or recovery statement, with its index within statements of that type
+type dccStatement struct {
+	statementType string
+	index         int
+
+	vaccination *hcertcommon.DCCVaccination
+	test        *hcertcommon.DCCTest
+	recovery    *hcertcommon.DCCRecovery
+}
+
+func dccStatements(dcc *hcertcommon.DCC) []*dccStatement {
+	var statements []*dccStatement
+	for i, vacc := range dcc.Vaccinations {
+		statements = append(statements, &dccStatement{statementType: DCC_STATEMENT_VACCINATION, index: i, vaccination: vacc})
+	}
+
+	for i, test := range dcc.Tests {
+		statements = append(statements, &dccStatement{statementType: DCC_STATEMENT_TEST, index: i, test: test})
+	}
+
+	for i, rec := range dcc.Recoveries {
+		statements = append(statements, &dccStatement{statementType: DCC_STATEMENT_RECOVERY, index: i, recovery: rec})
+	}
+
+	return statements
+}
+
+func (statement *dccStatement) String() string {
+	return fmt.Sprintf("%s:%d", statement.statementType, statement.index)
+}
+
+func (statement *dccStatement) validate(dob string, policy string, rules *europeanVerificationRules, now time.Time) error {
+	switch statement.statementType {
+	case DCC_STATEMENT_VACCINATION:
+		err := validateVaccination(statement.vaccination, dob, policy, rules, now)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid vaccination statement", 0)
+		}
+	case DCC_STATEMENT_TEST:
+		err := validateTest(statement.test, rules, now)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid test statement", 0)
+		}
+	default:
+		err := validateRecovery(statement.recovery, policy, rules, now)
+		if err != nil {
+			return errors.WrapPrefix(err, "Invalid recovery statement", 0)
+		}
+	}
+
+	return nil
+}
+
+func (statement *dccStatement) validity(dob string, rules *europeanVerificationRules) (validFrom, validUntil time.Time, err error) {
+	switch statement.statementType {
+	case DCC_STATEMENT_VACCINATION:
+		return vaccinationValidity(statement.vaccination, dob, rules)
+	case DCC_STATEMENT_TEST:
+		return testValidity(statement.test, rules)
+	default:
+		return recoveryValidity(statement.recovery, rules)
+	}
+}
+
+// mostFavorableStatement returns the statement that is valid until the latest moment,
+//  where the first statement is returned when multiple are valid equally long
+func mostFavorableStatement(statements []*dccStatement, dob string, rules *europeanVerificationRules) (*dccStatement, error) {
+	if len(statements) == 0 {
+		return nil, errors.Errorf("Contains no vaccination, test or recovery statements")
+	}
+
+	var mostFavorable *dccStatement
+	var mostFavorableValidUntil time.Time
+	for _, statement := range statements {
+		_, validUntil, err := statement.validity(dob, rules)
+		if err != nil {
+			return nil, err
+		}
+
+		if mostFavorable == nil || validUntil.After(mostFavorableValidUntil) {
+			mostFavorable = statement
+			mostFavorableValidUntil = validUntil
+		}
+	}
+
+	return mostFavorable, nil
+}
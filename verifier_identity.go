@@ -0,0 +1,271 @@
+package mobilecore
+
+import (
+	"encoding/json"
+	"github.com/go-errors/errors"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	IDENTITY_MATCH    = "match"
+	IDENTITY_MISMATCH = "mismatch"
+	IDENTITY_PARTIAL  = "partial"
+)
+
+// IdentityDocument contains the identity data to match against, either as the machine readable zone of
+//  a passport or ID card, or as manually entered names and (possibly partial) date of birth
+type IdentityDocument struct {
+	MRZ         string `json:"mrz"`
+	FirstName   string `json:"firstName"`
+	LastName    string `json:"lastName"`
+	DateOfBirth string `json:"dateOfBirth"`
+}
+
+// IdentityMatchResultValue lists the fields that differ, and the fields that couldn't be compared because
+//  either side is unknown. The status is only a match when all fields have been compared and are equal.
+type IdentityMatchResultValue struct {
+	Status           string   `json:"status"`
+	MismatchedFields []string `json:"mismatchedFields"`
+	UnknownFields    []string `json:"unknownFields"`
+}
+
+// icaoTransliterations contains the multi-letter transliterations of ICAO Doc 9303, where all other
+//  letters with diacritics are transliterated to their base letter
+var icaoTransliterations = map[rune]string{
+	'Ä': "AE", 'Æ': "AE", 'Å': "AA", 'Ö': "OE", 'Ø': "OE", 'Œ': "OE", 'Ü': "UE",
+	'ß': "SS", 'Þ': "TH", 'Ð': "D", 'Đ': "D", 'Ł': "L", 'Ħ': "H", 'Ĳ': "IJ",
+}
+
+var icaoBaseLetters = map[rune]rune{
+	'À': 'A', 'Á': 'A', 'Â': 'A', 'Ã': 'A', 'Ā': 'A', 'Ă': 'A', 'Ą': 'A',
+	'Ç': 'C', 'Ć': 'C', 'Ĉ': 'C', 'Ċ': 'C', 'Č': 'C',
+	'Ď': 'D',
+	'È': 'E', 'É': 'E', 'Ê': 'E', 'Ë': 'E', 'Ē': 'E', 'Ĕ': 'E', 'Ė': 'E', 'Ę': 'E', 'Ě': 'E',
+	'Ĝ': 'G', 'Ğ': 'G', 'Ġ': 'G', 'Ģ': 'G',
+	'Ĥ': 'H',
+	'Ì': 'I', 'Í': 'I', 'Î': 'I', 'Ï': 'I', 'Ĩ': 'I', 'Ī': 'I', 'Ĭ': 'I', 'Į': 'I', 'İ': 'I',
+	'Ĵ': 'J',
+	'Ķ': 'K',
+	'Ĺ': 'L', 'Ļ': 'L', 'Ľ': 'L', 'Ŀ': 'L',
+	'Ñ': 'N', 'Ń': 'N', 'Ņ': 'N', 'Ň': 'N',
+	'Ò': 'O', 'Ó': 'O', 'Ô': 'O', 'Õ': 'O', 'Ō': 'O', 'Ŏ': 'O', 'Ő': 'O',
+	'Ŕ': 'R', 'Ŗ': 'R', 'Ř': 'R',
+	'Ś': 'S', 'Ŝ': 'S', 'Ş': 'S', 'Š': 'S', 'Ș': 'S',
+	'Ţ': 'T', 'Ť': 'T', 'Ț': 'T',
+	'Ù': 'U', 'Ú': 'U', 'Û': 'U', 'Ũ': 'U', 'Ū': 'U', 'Ŭ': 'U', 'Ů': 'U', 'Ű': 'U', 'Ų': 'U',
+	'Ŵ': 'W',
+	'Ý': 'Y', 'Ÿ': 'Y', 'Ŷ': 'Y',
+	'Ź': 'Z', 'Ż': 'Z', 'Ž': 'Z',
+}
+
+// MatchIdentity compares the verification details with the given JSON encoded identity document
+func MatchIdentity(details *VerificationDetails, identityDocumentJson []byte) *Result {
+	if details == nil {
+		return ErrorResult(errors.Errorf("No verification details were provided"))
+	}
+
+	identityDocument := &IdentityDocument{}
+	err := json.Unmarshal(identityDocumentJson, identityDocument)
+	if err != nil {
+		return WrappedErrorResult(err, "Could not JSON unmarshal identity document")
+	}
+
+	identityDetails, err := identityDocumentDetails(identityDocument)
+	if err != nil {
+		return ErrorResult(err)
+	}
+
+	resultJson, err := json.Marshal(matchIdentity(details, identityDetails))
+	if err != nil {
+		return WrappedErrorResult(err, "Could not JSON marshal identity match")
+	}
+
+	return &Result{resultJson, ""}
+}
+
+func matchIdentity(details, identityDetails *VerificationDetails) *IdentityMatchResultValue {
+	result := &IdentityMatchResultValue{
+		MismatchedFields: []string{},
+		UnknownFields:    []string{},
+	}
+
+	fields := []struct {
+		name             string
+		value, compareTo string
+	}{
+		{"firstNameInitial", details.FirstNameInitial, identityDetails.FirstNameInitial},
+		{"lastNameInitial", details.LastNameInitial, identityDetails.LastNameInitial},
+		{"birthDay", normalizeDayMonth(details.BirthDay), normalizeDayMonth(identityDetails.BirthDay)},
+		{"birthMonth", normalizeDayMonth(details.BirthMonth), normalizeDayMonth(identityDetails.BirthMonth)},
+	}
+
+	for _, field := range fields {
+		if field.value == "" || field.compareTo == "" {
+			result.UnknownFields = append(result.UnknownFields, field.name)
+		} else if !strings.EqualFold(field.value, field.compareTo) {
+			result.MismatchedFields = append(result.MismatchedFields, field.name)
+		}
+	}
+
+	if len(result.MismatchedFields) > 0 {
+		result.Status = IDENTITY_MISMATCH
+	} else if len(result.UnknownFields) > 0 {
+		result.Status = IDENTITY_PARTIAL
+	} else {
+		result.Status = IDENTITY_MATCH
+	}
+
+	return result
+}
+
+// identityDocumentDetails reduces the identity document to the same initials and birth day and month
+//  as the verification details, where unknown values are left empty
+func identityDocumentDetails(identityDocument *IdentityDocument) (*VerificationDetails, error) {
+	firstName, lastName, dob := identityDocument.FirstName, identityDocument.LastName, identityDocument.DateOfBirth
+	if identityDocument.MRZ != "" {
+		var err error
+		firstName, lastName, dob, err = parseMRZ(identityDocument.MRZ)
+		if err != nil {
+			return nil, errors.WrapPrefix(err, "Could not parse MRZ", 0)
+		}
+	}
+
+	_, birthMonth, birthDay, err := parseDateOfBirth(dob)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not parse date of birth", 0)
+	}
+
+	return &VerificationDetails{
+		FirstNameInitial: nameInitial(firstName),
+		LastNameInitial:  nameInitial(lastName),
+		BirthDay:         birthDay,
+		BirthMonth:       birthMonth,
+	}, nil
+}
+
+// parseMRZ reads the names and date of birth from a TD1 (ID card), TD2 or TD3 (passport) machine readable zone.
+//  The lines may be separated by newlines. The century of the date of birth is irrelevant for matching.
+func parseMRZ(mrz string) (firstName, lastName, dob string, err error) {
+	mrz = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+
+		return unicode.ToUpper(r)
+	}, mrz)
+
+	var names, dobField string
+	switch len(mrz) {
+	case 90:
+		names, dobField = mrz[60:90], mrz[30:37]
+	case 72:
+		names, dobField = mrz[5:36], mrz[49:56]
+	case 88:
+		names, dobField = mrz[5:44], mrz[57:64]
+	default:
+		return "", "", "", errors.Errorf("Unrecognized MRZ length")
+	}
+
+	// The names are formatted as PRIMARY<<SECONDARY, with filler characters between name parts
+	parts := strings.SplitN(strings.TrimRight(names, "<"), "<<", 2)
+	lastName = strings.ReplaceAll(parts[0], "<", " ")
+	if len(parts) > 1 {
+		firstName = strings.ReplaceAll(parts[1], "<", " ")
+	}
+
+	dob, err = parseMRZDateOfBirth(dobField)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	return firstName, lastName, dob, nil
+}
+
+// parseMRZDateOfBirth returns the YYMMDD date of birth with check digit as a partial date of birth,
+//  where an unknown month or day is denoted by filler characters
+func parseMRZDateOfBirth(dobField string) (string, error) {
+	if mrzCheckDigit(dobField[:6]) != dobField[6] {
+		return "", errors.Errorf("Invalid date of birth check digit")
+	}
+
+	// Use a fixed century, as it isn't compared
+	year, month, day := "19"+dobField[0:2], dobField[2:4], dobField[4:6]
+	if strings.Contains(year, "<") {
+		return "", nil
+	}
+
+	if strings.Contains(month, "<") {
+		return year, nil
+	}
+
+	if strings.Contains(day, "<") {
+		return year + "-" + month, nil
+	}
+
+	return year + "-" + month + "-" + day, nil
+}
+
+func mrzCheckDigit(value string) byte {
+	weights := []int{7, 3, 1}
+
+	sum := 0
+	for i, c := range value {
+		var v int
+		switch {
+		case c >= '0' && c <= '9':
+			v = int(c - '0')
+		case c >= 'A' && c <= 'Z':
+			v = int(c-'A') + 10
+		default:
+			v = 0
+		}
+
+		sum += v * weights[i%3]
+	}
+
+	return byte('0' + sum%10)
+}
+
+// nameInitial returns the first letter of the ICAO transliterated name, or an empty string if there is none
+func nameInitial(name string) string {
+	for _, r := range strings.ToUpper(name) {
+		transliterated := transliterateICAO(r)
+		if transliterated != "" {
+			return transliterated[0:1]
+		}
+	}
+
+	return ""
+}
+
+func transliterateICAO(r rune) string {
+	if r >= 'A' && r <= 'Z' {
+		return string(r)
+	}
+
+	if transliterated, ok := icaoTransliterations[r]; ok {
+		return transliterated
+	}
+
+	if base, ok := icaoBaseLetters[r]; ok {
+		return string(base)
+	}
+
+	return ""
+}
+
+// normalizeDayMonth strips leading zeroes of a birth day or month, and treats the unknown value as empty
+func normalizeDayMonth(value string) string {
+	if value == DOB_EMPTY_VALUE {
+		return ""
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return value
+	}
+
+	return strconv.Itoa(number)
+}
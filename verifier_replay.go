@@ -0,0 +1,100 @@
+package mobilecore
+
+import (
+	"encoding/base64"
+	"github.com/go-errors/errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// REPLAY_CACHE_MAXIMUM_SIZE bounds the memory of the replay cache, where the oldest entries are evicted first
+	REPLAY_CACHE_MAXIMUM_SIZE = 10000
+)
+
+type replayCacheEntry struct {
+	key                 string
+	seenUnixTimeSeconds int64
+}
+
+var (
+	replayCacheMutex    sync.Mutex
+	replayWindowSeconds int64
+	replayCacheSeen     map[string]int64
+	replayCacheOrder    []*replayCacheEntry
+)
+
+// EnableReplayDetection makes the verifier remember presented domestic proofs for the given amount of seconds,
+//  so that a forwarded screenshot of a QR code that was scanned before gets a dedicated status. Paper proofs
+//  are not subject to replay detection, as they are meant to be scanned repeatedly.
+func EnableReplayDetection(windowSeconds int64) *Result {
+	if windowSeconds <= 0 {
+		return ErrorResult(errors.Errorf("The replay window should be positive"))
+	}
+
+	replayCacheMutex.Lock()
+	defer replayCacheMutex.Unlock()
+
+	replayWindowSeconds = windowSeconds
+	replayCacheSeen = map[string]int64{}
+	replayCacheOrder = nil
+
+	return &Result{nil, ""}
+}
+
+func DisableReplayDetection() {
+	replayCacheMutex.Lock()
+	defer replayCacheMutex.Unlock()
+
+	replayWindowSeconds = 0
+	replayCacheSeen = nil
+	replayCacheOrder = nil
+}
+
+// checkReplay returns if the proof has been presented within the replay window, and records it otherwise
+func checkReplay(proofIdentifier []byte, disclosureTimeSeconds int64, now time.Time) bool {
+	replayCacheMutex.Lock()
+	defer replayCacheMutex.Unlock()
+
+	if replayWindowSeconds == 0 {
+		return false
+	}
+
+	pruneReplayCache(now)
+
+	key := base64.StdEncoding.EncodeToString(proofIdentifier) + ":" + strconv.FormatInt(disclosureTimeSeconds, 10)
+	if _, ok := replayCacheSeen[key]; ok {
+		return true
+	}
+
+	if len(replayCacheOrder) >= REPLAY_CACHE_MAXIMUM_SIZE {
+		delete(replayCacheSeen, replayCacheOrder[0].key)
+		replayCacheOrder = replayCacheOrder[1:]
+	}
+
+	replayCacheSeen[key] = now.Unix()
+	replayCacheOrder = append(replayCacheOrder, &replayCacheEntry{
+		key:                 key,
+		seenUnixTimeSeconds: now.Unix(),
+	})
+
+	return false
+}
+
+// pruneReplayCache removes the entries that were seen before the replay window, from oldest to newest
+func pruneReplayCache(now time.Time) {
+	seenAfter := now.Unix() - replayWindowSeconds
+
+	pruneAmount := 0
+	for _, entry := range replayCacheOrder {
+		if entry.seenUnixTimeSeconds > seenAfter {
+			break
+		}
+
+		delete(replayCacheSeen, entry.key)
+		pruneAmount++
+	}
+
+	replayCacheOrder = replayCacheOrder[pruneAmount:]
+}
@@ -0,0 +1,158 @@
+package mobilecore
+
+import (
+	"encoding/json"
+	"github.com/go-errors/errors"
+	"sync"
+	"time"
+)
+
+// ScanLogStorage persists the scan log, so that the scan lock also holds after the app has been restarted.
+//  The scan log is passed as opaque JSON, and LoadScanLog should return an empty value if nothing was stored yet.
+type ScanLogStorage interface {
+	LoadScanLog() ([]byte, error)
+	StoreScanLog(scanLogJson []byte) error
+}
+
+// ScanLogEntry records that a verification took place with a certain policy. No personal data is logged.
+type ScanLogEntry struct {
+	Policy          string `json:"policy"`
+	UnixTimeSeconds int64  `json:"unixTimeSeconds"`
+}
+
+var (
+	scanLogMutex   sync.Mutex
+	scanLogEnabled bool
+	scanLogStorage ScanLogStorage
+	scanLog        []*ScanLogEntry
+)
+
+// EnableScanLog starts recording verifications and enforcing the scan lock. The storage can be nil, in which
+//  case the scan log is only kept in memory. InitializeVerifier must have been called first.
+func EnableScanLog(storage ScanLogStorage) *Result {
+	if verifierConfig == nil {
+		return ErrorResult(errors.Errorf("The verifier must be initialized before enabling the scan log"))
+	}
+
+	entries := []*ScanLogEntry{}
+	if storage != nil {
+		scanLogJson, err := storage.LoadScanLog()
+		if err != nil {
+			return WrappedErrorResult(err, "Could not load scan log")
+		}
+
+		if len(scanLogJson) > 0 {
+			err = json.Unmarshal(scanLogJson, &entries)
+			if err != nil {
+				return WrappedErrorResult(err, "Could not JSON unmarshal scan log")
+			}
+		}
+	}
+
+	scanLogMutex.Lock()
+	defer scanLogMutex.Unlock()
+
+	scanLogEnabled = true
+	scanLogStorage = storage
+	scanLog = entries
+
+	return &Result{nil, ""}
+}
+
+func DisableScanLog() {
+	scanLogMutex.Lock()
+	defer scanLogMutex.Unlock()
+
+	scanLogEnabled = false
+	scanLogStorage = nil
+	scanLog = nil
+}
+
+// GetScanLog returns the JSON encoded entries of the scan log that are within the storage window
+func GetScanLog() *Result {
+	return getScanLog(time.Now())
+}
+
+func getScanLog(now time.Time) *Result {
+	scanLogMutex.Lock()
+	defer scanLogMutex.Unlock()
+
+	if !scanLogEnabled {
+		return ErrorResult(errors.Errorf("The scan log is not enabled"))
+	}
+
+	entriesJson, err := json.Marshal(pruneScanLog(scanLog, now))
+	if err != nil {
+		return WrappedErrorResult(err, "Could not JSON marshal scan log")
+	}
+
+	return &Result{entriesJson, ""}
+}
+
+// checkAndLogScan refuses a scan when another policy has been used within the scan lock window,
+//  and warns when another policy has been used within the warning window right before this scan.
+//  Accepted scans are logged before the actual verification takes place.
+func checkAndLogScan(policy string, now time.Time) (scanLockWarning, isLocked bool, err error) {
+	scanLogMutex.Lock()
+	defer scanLogMutex.Unlock()
+
+	if !scanLogEnabled {
+		return false, false, nil
+	}
+
+	entries := pruneScanLog(scanLog, now)
+	lockedAfter := now.Unix() - verifierConfig.ScanLockSeconds
+	warnedAfter := now.Unix() - verifierConfig.ScanLockWarningSeconds
+
+	for _, entry := range entries {
+		if entry.Policy != policy && entry.UnixTimeSeconds > lockedAfter {
+			return false, true, errors.Errorf("Scanning is locked after switching verification policy")
+		}
+	}
+
+	// Only warn for the scan that switches policy, which is when the previous scan used another policy
+	var lastEntry *ScanLogEntry
+	for _, entry := range entries {
+		if lastEntry == nil || entry.UnixTimeSeconds >= lastEntry.UnixTimeSeconds {
+			lastEntry = entry
+		}
+	}
+
+	if lastEntry != nil {
+		scanLockWarning = lastEntry.Policy != policy && lastEntry.UnixTimeSeconds > warnedAfter
+	}
+
+	entries = append(entries, &ScanLogEntry{
+		Policy:          policy,
+		UnixTimeSeconds: now.Unix(),
+	})
+
+	if scanLogStorage != nil {
+		entriesJson, err := json.Marshal(entries)
+		if err != nil {
+			return false, false, errors.WrapPrefix(err, "Could not JSON marshal scan log", 0)
+		}
+
+		err = scanLogStorage.StoreScanLog(entriesJson)
+		if err != nil {
+			return false, false, errors.WrapPrefix(err, "Could not store scan log", 0)
+		}
+	}
+
+	scanLog = entries
+	return scanLockWarning, false, nil
+}
+
+// pruneScanLog returns the entries that are within the storage window
+func pruneScanLog(entries []*ScanLogEntry, now time.Time) []*ScanLogEntry {
+	storedAfter := now.Unix() - verifierConfig.ScanLogStorageSeconds
+
+	pruned := make([]*ScanLogEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.UnixTimeSeconds > storedAfter {
+			pruned = append(pruned, entry)
+		}
+	}
+
+	return pruned
+}